@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// cacheFormat format version of cache entries, change it when fields of version.Info change meaning
+const cacheFormat = `1`
+
+// cacheEntry result of version.Describe cached in a file named by its key
+type cacheEntry struct {
+	Created time.Time    `json:"created"`
+	Info    version.Info `json:"info"`
+}
+
+// resultCache cache of version.Describe results in dir, keyed by repository path, repository state and options
+type resultCache struct {
+	dir    string
+	logger *slog.Logger
+}
+
+// newResultCache get cache in dir, or 'gv' in user cache dir if dir is empty
+func newResultCache(dir string, logger *slog.Logger) (*resultCache, error) {
+	if dir == `` {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, `gv`)
+	}
+	return &resultCache{dir: dir, logger: logger}, nil
+}
+
+// key get cache key of repository gitRoot described with opts, the repository state is read by version.State,
+// so tags moved without HEAD moving, or files staged in the index, give another key
+func (c *resultCache) key(gitRoot string, opts version.Options) (string, error) {
+	abs, err := filepath.Abs(gitRoot)
+	if err != nil {
+		return ``, err
+	}
+	state, err := version.State(abs)
+	if err != nil {
+		return ``, fmt.Errorf("get repository state: %w", err)
+	}
+	sourceDate := opts.SourceDate.UnixNano()
+	opts.Logger, opts.SourceDate = nil, time.Time{} // time.Time has location pointer, which differs in each process
+	build := `(unknown)`
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		build = bi.Main.Version
+		for _, s := range bi.Settings {
+			if s.Key == `vcs.revision` {
+				build += ` ` + s.Value
+			}
+		}
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%d\n%#v\n", cacheFormat, build, abs, state, sourceDate, opts)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// get get cached Info of key, false if there is none or it is unreadable,
+// RepoAge is moved forward by the time since the entry was created unless SourceDate fixes now
+func (c *resultCache) get(key string, opts version.Options) (info version.Info, ok bool) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key+`.json`))
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	var entry cacheEntry
+	if err == nil {
+		err = json.Unmarshal(data, &entry)
+	}
+	if err != nil {
+		c.logger.Warn("read cached result", `key`, key, `err`, err)
+		return
+	}
+	info = entry.Info
+	if age, err := time.ParseDuration(info.RepoAge); err == nil && opts.SourceDate.IsZero() {
+		info.RepoAge = (age + time.Since(entry.Created)).Round(time.Second).String()
+	}
+	return info, true
+}
+
+// put cache Info of key, failure is only logged since the result is already computed
+func (c *resultCache) put(key string, info version.Info) {
+	data, err := json.Marshal(cacheEntry{Created: time.Now(), Info: info})
+	if err == nil {
+		err = os.MkdirAll(c.dir, 0o755)
+	}
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(c.dir, key+`.json`), data)
+	}
+	if err != nil {
+		c.logger.Warn("write cached result", `dir`, c.dir, `err`, err)
+	}
+}
+
+// clear remove all cached results, a missing cache dir is not an error
+func (c *resultCache) clear() error {
+	entries, err := filepath.Glob(filepath.Join(c.dir, `*.json`))
+	if err != nil {
+		return err
+	}
+	for _, name := range entries {
+		if err = os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe get version.Describe result of gitRoot from cache, or describe and cache it,
+// the cache is skipped for options whose result depends on files version.State does not cover
+func (c *resultCache) describe(ctx context.Context, gitRoot string, opts version.Options) (version.Info, error) {
+	if opts.DirtyUntracked || opts.Submodules {
+		c.logger.Debug("skip cache, result depends on untracked files or submodules")
+		return version.Describe(ctx, gitRoot, opts)
+	}
+	key, err := c.key(gitRoot, opts)
+	if err != nil {
+		c.logger.Warn("skip cache", `err`, err)
+		return version.Describe(ctx, gitRoot, opts)
+	}
+	if info, ok := c.get(key, opts); ok {
+		c.logger.Debug("cache hit", `key`, key)
+		return info, nil
+	}
+	c.logger.Debug("cache miss", `key`, key)
+	info, err := version.Describe(ctx, gitRoot, opts)
+	if err == nil {
+		c.put(key, info)
+	}
+	return info, err
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// ciEnvs CI systems and the env vars detecting them, in detection order
+var ciEnvs = [][2]string{
+	{`github`, `GITHUB_ACTIONS`},
+	{`gitlab`, `GITLAB_CI`},
+	{`teamcity`, `TEAMCITY_VERSION`},
+	{`azdo`, `TF_BUILD`},
+	{`jenkins`, `JENKINS_URL`},
+}
+
+// ciSystems get names of supported CI systems
+func ciSystems() (systems []string) {
+	for _, e := range ciEnvs {
+		systems = append(systems, e[0])
+	}
+	return
+}
+
+// detectCI detect CI system by env vars, empty if not running in a supported CI system
+func detectCI(getenv func(string) string, logger *slog.Logger) string {
+	for _, e := range ciEnvs {
+		if getenv(e[1]) != `` {
+			logger.Debug("detect CI system", `ci`, e[0], `env`, e[1])
+			return e[0]
+		}
+	}
+	logger.Debug("no supported CI system detected, use plain output", `CI`, getenv(`CI`))
+	return ``
+}
+
+// ciBranch get branch checked out by CI system from env vars, empty if not running in CI or not building a branch,
+// CI systems usually check out detached HEAD, so the branch is not found in repository
+func ciBranch(getenv func(string) string) string {
+	if branch := getenv(`GITHUB_HEAD_REF`); branch != `` { // pull request source branch
+		return branch
+	}
+	if getenv(`GITHUB_REF_TYPE`) == `branch` {
+		return getenv(`GITHUB_REF_NAME`)
+	}
+	if branch := getenv(`CI_MERGE_REQUEST_SOURCE_BRANCH_NAME`); branch != `` { // GitLab merge request pipeline
+		return branch
+	}
+	if branch := getenv(`CI_COMMIT_BRANCH`); branch != `` { // GitLab branch pipeline
+		return branch
+	}
+	if branch, ok := strings.CutPrefix(getenv(`BUILD_SOURCEBRANCH`), `refs/heads/`); ok && getenv(`TF_BUILD`) != `` {
+		return branch
+	}
+	if getenv(`JENKINS_URL`) != `` && getenv(`CHANGE_ID`) == `` { // multibranch pipeline, not a pull request
+		return getenv(`BRANCH_NAME`)
+	}
+	return ``
+}
+
+// ciTag get tag built by CI system from env vars, empty if not building a tag
+func ciTag(getenv func(string) string) string {
+	if getenv(`GITHUB_REF_TYPE`) == `tag` {
+		return getenv(`GITHUB_REF_NAME`)
+	}
+	return getenv(`CI_COMMIT_TAG`)
+}
+
+// ciCommit get commit built by CI system from env vars, empty if not running in CI
+func ciCommit(getenv func(string) string) string {
+	for _, name := range []string{`GITHUB_SHA`, `CI_COMMIT_SHA`, `BUILD_SOURCEVERSION`, `GIT_COMMIT`} {
+		if commit := getenv(name); commit != `` {
+			return commit
+		}
+	}
+	return ``
+}
+
+// ciBuildNumbers env vars of build number of each CI system
+var ciBuildNumbers = map[string]string{
+	`github`:   `GITHUB_RUN_NUMBER`,
+	`gitlab`:   `CI_PIPELINE_IID`,
+	`azdo`:     `BUILD_BUILDID`,
+	`jenkins`:  `BUILD_NUMBER`,
+	`teamcity`: `BUILD_NUMBER`,
+}
+
+// ciBuildNumber get build number of detected CI system from env vars, empty if not running in CI
+func ciBuildNumber(getenv func(string) string, logger *slog.Logger) string {
+	return getenv(ciBuildNumbers[detectCI(getenv, logger)])
+}
+
+// buildMetadata get semantic version build metadata 'build.<N>' of build number, characters other than
+// [0-9A-Za-z-] are replaced with '-', e.g. TeamCity build number '1.2 (rc)', empty if number is empty
+func buildMetadata(number string) string {
+	var ids []string
+	for _, id := range strings.Split(number, `.`) {
+		id = strings.Map(func(r rune) rune {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '-' {
+				return r
+			}
+			return '-'
+		}, strings.TrimSpace(id))
+		if id != `` {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return ``
+	}
+	return `build.` + strings.Join(ids, `.`)
+}
+
+// enableCI enable integration output of CI system, plain output if system is empty,
+// return false if system is unknown
+func (o *options) enableCI(system string) bool {
+	switch system {
+	case ``:
+	case `github`:
+		o.gha = true
+	case `gitlab`:
+		if o.dotenv == `` {
+			o.dotenv = `gv.env`
+		}
+	case `teamcity`:
+		o.teamcity = true
+	case `azdo`:
+		o.azdo = true
+	case `jenkins`:
+		if o.jenkinsProps == `` {
+			o.jenkinsProps = `gv.properties`
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// teamcityEscaper escape value in TeamCity service message
+var teamcityEscaper = strings.NewReplacer(
+	`|`, `||`, `'`, `|'`, `[`, `|[`, `]`, `|]`, "\n", `|n`, "\r", `|r`,
+	"\u0085", `|x`, "\u2028", `|l`, "\u2029", `|p`,
+)
+
+// writeTeamCity write TeamCity service messages to set build number to version,
+// and build parameters of version information
+func writeTeamCity(w io.Writer, info version.Info) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "##teamcity[buildNumber '%s']\n", teamcityEscaper.Replace(info.Version))
+	for _, p := range [][2]string{
+		{`gv.version`, info.Version},
+		{`gv.tag`, info.Tag},
+		{`gv.branch`, info.Branch},
+		{`gv.commit`, info.CommitID},
+		{`gv.date`, info.CommitTime},
+	} {
+		fmt.Fprintf(&buf, "##teamcity[setParameter name='%s' value='%s']\n", p[0], teamcityEscaper.Replace(p[1]))
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// azdoEscaper escape value of Azure DevOps logging command
+var azdoEscaper = strings.NewReplacer(`%`, `%AZP25`, "\r", `%0D`, "\n", `%0A`)
+
+// writeAzureDevOps write Azure DevOps logging commands to set variables of version information,
+// and update build number to version if buildNumber is true
+func writeAzureDevOps(w io.Writer, info version.Info, isOutput, buildNumber bool) error {
+	var buf bytes.Buffer
+	for _, name := range version.Fields {
+		fmt.Fprintf(&buf, "##vso[task.setvariable variable=%s;isOutput=%t]%s\n", name, isOutput, azdoEscaper.Replace(info.Get(name)))
+	}
+	if buildNumber {
+		fmt.Fprintf(&buf, "##vso[build.updatebuildnumber]%s\n", azdoEscaper.Replace(info.Version))
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// writeGitHub append version information to the GitHub Actions file named by env var,
+// names are snake case of Fields with prefix, e.g. 'commit_id', or in upper case, e.g. 'GV_COMMIT_ID'.
+// Multiline values are written with heredoc delimiter.
+func writeGitHub(env string, info version.Info, prefix string, upper bool) error {
+	path := os.Getenv(env)
+	if path == `` {
+		return fmt.Errorf("env %s is not set, not running in GitHub Actions", env)
+	}
+	var buf bytes.Buffer
+	for _, field := range version.Fields {
+		name := prefix + snakeCase(field)
+		if upper {
+			name = strings.ToUpper(name)
+		}
+		value := info.Get(field)
+		if !strings.ContainsAny(value, "\r\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", name, value)
+			continue
+		}
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("generate delimiter: %w", err)
+		}
+		delimiter := `ghadelimiter_` + hex.EncodeToString(b)
+		fmt.Fprintf(&buf, "%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = buf.WriteTo(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// snakeCase convert camel case field name to snake case, e.g. 'CommitID' to 'commit_id'
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, c := range name {
+		if i > 0 && unicode.IsUpper(c) && unicode.IsLower(rune(name[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// dotenvVars build dotenv file of GV_ prefixed version information, e.g. 'GV_COMMIT_ID=...',
+// line breaks in values are replaced with spaces since dotenv values are single line
+func dotenvVars(info version.Info) []byte {
+	var buf bytes.Buffer
+	for _, field := range version.Fields {
+		value := strings.NewReplacer("\r\n", ` `, "\n", ` `, "\r", ` `).Replace(info.Get(field))
+		fmt.Fprintf(&buf, "GV_%s=%s\n", strings.ToUpper(snakeCase(field)), value)
+	}
+	return buf.Bytes()
+}
+
+// jenkinsProperties build Java properties file of version information with key prefix,
+// for Jenkins EnvInject plugin or readProperties step
+func jenkinsProperties(info version.Info, prefix string) []byte {
+	var buf bytes.Buffer
+	for _, p := range [][2]string{
+		{`VERSION`, info.Version},
+		{`GIT_TAG`, info.Tag},
+		{`GIT_BRANCH`, info.Branch},
+		{`GIT_COMMIT`, info.CommitID},
+		{`GIT_COMMIT_TIME`, info.CommitTime},
+	} {
+		fmt.Fprintf(&buf, "%s=%s\n", escapeProperty(prefix+p[0], true), escapeProperty(p[1], false))
+	}
+	return buf.Bytes()
+}
+
+// escapeProperty escape key or value in Java properties file,
+// characters out of printable ASCII are written as '\uXXXX' in UTF-16
+func escapeProperty(s string, key bool) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c == '\\' || c == '=' || c == ':' || c == '#' || c == '!':
+			b.WriteString(`\` + string(c))
+		case c == ' ' && (key || i == 0):
+			b.WriteString(`\ `)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\f':
+			b.WriteString(`\f`)
+		case c < 0x20 || c > 0x7e:
+			for _, u := range utf16.Encode([]rune{c}) {
+				fmt.Fprintf(&b, `\u%04x`, u)
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// writeFileAtomic write data to file through a temporary file in the same dir,
+// readers never see a partially written file
+func writeFileAtomic(name string, data []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(name), `.`+filepath.Base(name)+`.*`)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Chmod(0o644); err != nil {
+		_ = f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// repoConfigName name of in-repo configuration file next to '.git' dir
+const repoConfigName = `.gitversion`
+
+// repoConfigVersion supported format version of repoConfigName
+const repoConfigVersion = `1`
+
+// repoConfigKeys flags which can be pinned in repoConfigName, they change how the version is resolved
+var repoConfigKeys = []string{
+	`abbrev`, `date-format`, `tz`, `date`, `pseudo-format`, `module`, `branch-in-version`, `branch-length`,
+	`snapshot`, `snapshot-unique`, `tag-prefix`, `loose`, `semver-only`, `strict-tags`, `compat`, `path`, `ignore`, `release-branches`, `branch-priority`, `build-number`,
+	`version-file`, `notes-ref`, `check-module`, `channels`, `channel-in-version`, `content-hash`, `dirty-hash`, `dirty-untracked`, `prefer-tag-type`, `subject-length`, `cache`, `contributors`, `diffstat`, `submodules`, `tag-namespace`, `tag-branches`, `ci-build-meta`,
+}
+
+// loadRepoConfig set flags from repoConfigName in worktree of gitRoot, flags set in command line are kept,
+// the file has a 'version' key and 'key = value' or 'key: value' lines of repoConfigKeys, '#' starts comment line,
+// a missing file is not an error
+func loadRepoConfig(fs *flag.FlagSet, gitRoot string, logger *slog.Logger) error {
+	name := filepath.Join(version.WorktreeDir(gitRoot), repoConfigName)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var settings [][2]string
+	var formatVersion string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == `` || strings.HasPrefix(line, `#`) {
+			continue
+		}
+		i := strings.IndexAny(line, `=:`)
+		if i < 0 {
+			return fmt.Errorf("%s:%d: invalid line %q, want 'key = value'", name, n, line)
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+		switch {
+		case key == `version`:
+			formatVersion = value
+		case slices.Contains(repoConfigKeys, key):
+			settings = append(settings, [2]string{key, value})
+		default:
+			return fmt.Errorf("%s:%d: unknown key %s, valid: version, %s", name, n, key, strings.Join(repoConfigKeys, `, `))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	if formatVersion != repoConfigVersion {
+		return fmt.Errorf("%s: unsupported version %q, want %s", name, formatVersion, repoConfigVersion)
+	}
+	for _, s := range settings {
+		if set[s[0]] {
+			logger.Debug("setting from "+repoConfigName+" is overridden by command line", `name`, s[0], `value`, s[1])
+			continue
+		}
+		if err = fs.Set(s[0], s[1]); err != nil {
+			return fmt.Errorf("%s: invalid value %q of %s: %w", name, s[1], s[0], err)
+		}
+		logger.Debug("setting from "+repoConfigName, `name`, s[0], `value`, s[1])
+	}
+	return nil
+}
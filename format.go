@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// formatFuncs helper functions of -format templates, the piped value is the last argument,
+// date reads time fields in *dateFormat when the template is executed, after repository config may set it
+func formatFuncs(dateFormat *string) template.FuncMap {
+	return template.FuncMap{
+		`short`: func(n int, s string) string { return s[:min(max(n, 0), len(s))] },
+		`date`: func(layout, s string) (string, error) {
+			t, err := version.ParseDate(s, *dateFormat)
+			if err != nil {
+				return ``, err
+			}
+			return t.Format(layout), nil
+		},
+		`upper`:    strings.ToUpper,
+		`lower`:    strings.ToLower,
+		`replace`:  func(old, with, s string) string { return strings.ReplaceAll(s, old, with) },
+		`sanitize`: func(s string) string { return version.Sanitize(s, 0) },
+		`trimv`:    func(s string) string { return strings.TrimPrefix(s, `v`) },
+		`default`: func(fallback, s string) string {
+			if s == `` {
+				return fallback
+			}
+			return s
+		},
+		`env`: os.Getenv,
+	}
+}
+
+// formatHelp usage of -format templates printed by -help-format
+const formatHelp = `-format takes a Go text/template executed with the version information,
+fields are the ones of 'gv -a', e.g. {{.Version}}, {{.Branch}}, {{.CommitID}}, {{.CommitTime}}, {{.Tags}} (a list)
+
+Functions, the piped value is the last argument:
+  short <n>              first n characters          {{.CommitID | short 7}}        -> 759ac82
+  date <layout>          reformat time field         {{.CommitTime | date "2006-01-02"}} -> 2024-01-02
+                         with Go layout, the field is read in -date-format
+  upper, lower           change case                 {{.Branch | upper}}             -> MAIN
+  replace <old> <new>    replace all old with new    {{.Branch | replace "/" "_"}}   -> feature_login
+  sanitize               branch and Docker safe      {{.Branch | sanitize}}          -> feature-login
+  trimv                  strip leading 'v'           {{.Version | trimv}}            -> 1.2.3
+  default <fallback>     fallback for empty field    {{.Tag | default "untagged"}}   -> untagged
+  env <NAME>             environment variable        {{env "BUILD_ID"}}              -> 42
+
+Example:
+  gv -format '{{.Version | trimv}}+{{.CommitID | short 7}}'
+  gv -format '{{.Branch | sanitize}}-{{.CommitTime | date "20060102"}}-{{env "BUILD_ID" | default "0"}}'
+`
+
+// parseFormat parse -format template, unknown functions and syntax errors fail here instead of on execution
+func parseFormat(text string, dateFormat *string) (*template.Template, error) {
+	return template.New(`format`).Option(`missingkey=error`).Funcs(formatFuncs(dateFormat)).Parse(text)
+}
+
+// templateFields names in version.Fields which the template reads from the info, false if it reads the whole info,
+// e.g. with '{{.}}', '{{template "x" .}}' or '{{.Get "Commits"}}'
+func templateFields(t *template.Template) (names []string, ok bool) {
+	ok = true
+	field := func(name string) {
+		switch name {
+		case `Get`: // any field by name
+			ok = false
+		case `Signed`:
+			names = append(names, `Signature`)
+		case `BranchSource`:
+			names = append(names, `Branch`)
+		case `Authors`:
+			names = append(names, `Contributors`)
+		default:
+			names = append(names, name)
+		}
+	}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, n := range n.Nodes {
+					walk(n)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(&n.BranchNode)
+		case *parse.RangeNode:
+			walk(&n.BranchNode)
+		case *parse.WithNode:
+			walk(&n.BranchNode)
+		case *parse.BranchNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, c := range n.Cmds {
+					walk(c)
+				}
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			field(n.Ident[0])
+		case *parse.VariableNode:
+			if n.Ident[0] != `$` {
+				break
+			}
+			if len(n.Ident) == 1 {
+				ok = false
+			} else {
+				field(n.Ident[1])
+			}
+		case *parse.DotNode:
+			ok = false
+		}
+	}
+	for _, t := range t.Templates() {
+		if t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return !slices.Contains(version.Fields, name) })
+	slices.Sort(names)
+	return slices.Compact(names), ok
+}
+
+// replacement sed style regexp substitution of -replace
+type replacement struct {
+	re     *regexp.Regexp
+	with   string // replacement with '$1' style group references
+	global bool   // replace all matches instead of the first one
+}
+
+// parseReplacement parse 's/pattern/replacement/' with optional 'g' flag, any delimiter may follow 's',
+// e.g. 's/^v//', 's|-dirty.*||', 's/([0-9]+)\.([0-9]+)/$1_$2/g'
+func parseReplacement(expr string) (r replacement, err error) {
+	if len(expr) < 2 || expr[0] != 's' {
+		return r, fmt.Errorf("invalid replacement %q, want 's/pattern/replacement/'", expr)
+	}
+	parts := strings.Split(expr[2:], expr[1:2])
+	if len(parts) != 3 || parts[2] != `` && parts[2] != `g` {
+		return r, fmt.Errorf("invalid replacement %q, want 's/pattern/replacement/' with optional 'g' flag", expr)
+	}
+	if r.re, err = regexp.Compile(parts[0]); err != nil {
+		return r, fmt.Errorf("invalid replacement %q: %w", expr, err)
+	}
+	r.with, r.global = parts[1], parts[2] == `g`
+	return
+}
+
+// apply substitute the first match in s, or all matches if global
+func (r replacement) apply(s string) string {
+	if r.global {
+		return r.re.ReplaceAllString(s, r.with)
+	}
+	m := r.re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return s
+	}
+	return s[:m[0]] + string(r.re.ExpandString(nil, r.with, s, m)) + s[m[1]:]
+}
+
+// printableWriter writer of output whose bytes are converted by printable, each Write is converted on its own,
+// so callers write whole buffers, which never split a multi-byte character
+type printableWriter struct {
+	w io.Writer
+}
+
+func (p printableWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(printable(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// printable replace invalid UTF-8 with U+FFFD and remove C0 control characters except tab and newline,
+// e.g. Latin-1 bytes or escape sequences in tags and messages created by old tooling, which could corrupt terminal state
+func printable(b []byte) []byte {
+	return bytes.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' && r != '\n' {
+			return -1
+		}
+		return r
+	}, bytes.ToValidUTF8(b, []byte("\uFFFD")))
+}
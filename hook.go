@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// runExecFilter run command of -exec-filter in shell with GV_ prefixed env vars of info and info.Version on stdin,
+// get its trimmed stdout as the version, the command's stderr goes to stderr, it is killed after timeout if it is greater than 0
+func runExecFilter(ctx context.Context, stderr io.Writer, command string, timeout time.Duration, info version.Info) (string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	shell := []string{`sh`, `-c`}
+	if runtime.GOOS == `windows` {
+		shell = []string{`cmd`, `/C`}
+	}
+	cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], command)...)
+	cmd.Env = append(os.Environ(), strings.Split(strings.TrimSuffix(string(dotenvVars(info)), "\n"), "\n")...)
+	cmd.Stdin = strings.NewReader(info.Version + "\n")
+	var stdout bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, stderr
+	cmd.WaitDelay = time.Second // do not wait for pipes held open by children of a killed command
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ``, fmt.Errorf("run %q: killed after %s: %w", command, timeout, ctx.Err())
+	}
+	if err != nil {
+		return ``, fmt.Errorf("run %q: %w", command, err)
+	}
+	v := strings.TrimSpace(stdout.String())
+	if v == `` {
+		return ``, fmt.Errorf("run %q: no version in output", command)
+	}
+	return v, nil
+}
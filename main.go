@@ -3,381 +3,1267 @@ package main
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/fs"
 	"log/slog"
 	"os"
+	"os/user"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/yougg/gv/pkg/version"
 )
 
-var (
-	all   bool
-	showb bool
-	repo  string
+// options command line options of one run, flags are defined on them by newFlagSet
+type options struct {
+	all     bool
+	verbose bool
+	logFmt  string
+	logLvl  string
+	repo    string
+	field   string
+	format  string
+	filter  string
+	filterT time.Duration
+	replace []string      // -replace expressions
+	rules   []replacement // parsed replace
+	helpFmt bool
+	tmpl    *template.Template // parsed format
+	timeout time.Duration
+	raw     bool // write output as is, without printable
+	opts    version.Options
+
+	output        string
+	teamcity      bool
+	jenkinsProps  string
+	jenkinsPrefix string
+	azdo          bool
+	azdoOutput    bool
+	azdoBuild     bool
+	gha           bool
+	ghaEnv        bool
+	dotenv        string
+	ciMode        string
+	sbom          string
+	allTags       bool
+	requireTag    bool
+	requireMerged bool
+	dockerTag     bool
+	releases      string
+	priority      string
+	channels      string
+	trustedKeys   string
+	namespaces    string
+	noCIBranch    bool
+
+	discovery        version.DiscoveryOptions
+	discoveryExclude string
+
+	command   string   // sub command, empty for version
+	cmdArgs   []string // arguments of command
+	sortBy    string
+	since     string
+	jsonOut   bool
+	reachable bool
+	check     bool
+	trimV     bool
+	workspace bool
+
+	tagOpts     version.TagOptions
+	tagBranch   string
+	push        bool
+	printOnly   bool
+	bumpOpts    version.BumpOptions
+	autoPrefix  bool
+	ciBuildMeta bool
+	modDir      string // slash separated dir of nested go.mod found by -auto-prefix, empty if none
+
+	useCache   bool
+	noCache    bool
+	cacheClear bool
+	cacheDir   string
+}
+
+// commands valid sub commands
+var commands = []string{`changed`, `history`, `verify`, `note`, `write-version`, `check-order`, `check-module`, `autotag`, `promote`, `bump`}
+
+// listFlag repeatable flag collecting its values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ``
+	}
+	return strings.Join(*l, `,`)
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// exit codes
+const (
+	exitError           = 1
+	exitUsage           = 2
+	exitNoRepository    = 3
+	exitEmptyRepository = 4
+	exitDetachedHead    = 5
+	exitShallowHistory  = 6
+	exitNoBranchFound   = 7
+	exitUnchanged       = 8   // 'gv changed' found no commit modifying the paths since the tag
+	exitMismatch        = 9   // 'gv verify' found the version does not match the repository
+	exitUntagged        = 10  // -require-tag found no tag at HEAD
+	exitStale           = 11  // 'gv write-version -check' found the version file out of date
+	exitPartialClone    = 12  // objects needed are filtered out of partial clone
+	exitOutOfOrder      = 13  // 'gv check-order' found tags descending from higher versions
+	exitModuleMismatch  = 14  // 'gv check-module' found tags breaking Go module versioning
+	exitRefused         = 15  // 'gv autotag', 'gv promote' or 'gv bump' refused to tag: branch not allowed, dirty worktree, no prerelease, tag exists, version not higher or not matching go.mod
+	exitNotMerged       = 16  // -require-merged found HEAD not merged to default branch, or no default branch
+	exitLimit           = 17  // -max-commits, -max-tags or -max-branches exceeded, partial result resolved before it may be printed
+	exitTimeout         = 124 // timeout, same as timeout(1), partial result resolved before it may be printed
 )
 
-func init() {
-	flag.BoolVar(&all, `a`, false, "show all version information")
-	flag.BoolVar(&showb, `b`, false, "show branch name instead of tag")
-	flag.StringVar(&repo, `r`, ``, "git repository path")
-	flag.Usage = func() {
-		fmt.Println("Usage: gv")
-		flag.PrintDefaults()
-		fmt.Println("Example:")
-		fmt.Println("\tgv -r /path/to/repo/")
-		fmt.Println("\tgv -a -r /path/to/repo/")
-		fmt.Println("\tcd /path/to/repo/ && gv")
-		fmt.Println("\tcd /path/to/repo/ && gv -a")
-	}
-	flag.Parse()
+// newFlagSet define flags of options o with their defaults in a new flag set reporting errors to stderr
+func newFlagSet(o *options, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(`gv`, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.BoolVar(&o.all, `a`, false, "show all version information")
+	fs.BoolVar(&o.verbose, `v`, false, "log debug diagnostics, e.g. settings from "+repoConfigName+", same as -log-level debug")
+	fs.StringVar(&o.logFmt, `log-format`, `text`, "format of diagnostics on stderr: text, json")
+	fs.StringVar(&o.logLvl, `log-level`, `info`, "min level of diagnostics on stderr: debug, info, warn, error")
+	fs.BoolVar(&o.opts.ShowBranch, `b`, false, "show branch name instead of tag")
+	fs.StringVar(&o.repo, `r`, ``, "git repository path")
+	fs.StringVar(&o.opts.Commit, `commit`, ``, "full or abbreviated commit hash to get version at instead of HEAD, same as 'gv <hash>'")
+	fs.StringVar(&o.opts.Ref, `ref`, ``, "revision to get version at instead of HEAD, e.g. 'origin/release-1.8', 'v1.2.3', 'HEAD~3'")
+	fs.IntVar(&o.opts.Abbrev, `abbrev`, 0, "abbreviated commit hash length (4-40), default 12 in version and git's automatic length in Describe and -compat describe")
+	fs.StringVar(&o.opts.DateFormat, `date-format`, `compact`, "commit time format: compact, rfc3339, iso8601, unix or Go layout")
+	fs.StringVar(&o.opts.TimeZone, `tz`, `utc`, "commit time zone: utc, local, committer, always utc if SOURCE_DATE_EPOCH is set")
+	fs.StringVar(&o.opts.DateKind, `date`, `committer`, "commit time source: committer, author")
+	fs.StringVar(&o.opts.PseudoFormat, `pseudo-format`, `{ref}-{date}-{hash}`, "pseudo-version layout with placeholders: "+strings.Join(version.Placeholders, `, `))
+	fs.BoolVar(&o.opts.ContentHash, `content-hash`, false, "use abbreviated tree hash instead of commit hash in pseudo-version, commits with identical content get identical versions")
+	fs.BoolVar(&o.opts.DirtyHash, `dirty-hash`, false, "append '-dirty.<8 hex>' hash of uncommitted changes if worktree is dirty, same changes get same hash")
+	fs.BoolVar(&o.opts.DirtyUntracked, `dirty-untracked`, false, "include untracked files in -dirty-hash")
+	fs.BoolVar(&o.opts.BranchInVersion, `branch-in-version`, false, "include branch in pseudo-version as prerelease after the bumped tag, e.g. v1.5.0-featurefoo.20240607123455-abcdef123456")
+	fs.StringVar(&o.opts.TagPrefix, `tag-prefix`, ``, "only use tags with the prefix, e.g. 'foo/', the prefix is removed in version")
+	fs.BoolVar(&o.autoPrefix, `auto-prefix`, false, "use dir of nearest go.mod from -r or current dir in its repository as -tag-prefix like Go module tags, e.g. 'tools/' for 'tools/v1.2.3', no prefix for go.mod at repository root")
+	fs.StringVar(&o.opts.Compat, `compat`, ``, "print version exactly like another tool instead of gv rules: describe ('git describe --tags --always --dirty')")
+	fs.BoolVar(&o.opts.StrictTags, `strict-tags`, false, "fail if version tags on the commit of the chosen tag differ in major or minor version, e.g. v1.4.0 and v2.0.0, only warn without it")
+	fs.BoolVar(&o.opts.SemverOnly, `semver-only`, false, "only use tags which are semantic versions, e.g. skip 'sprint-42' to find an older version tag")
+	fs.BoolVar(&o.opts.LooseVersions, `loose`, false, "tags with any text before the version after -tag-prefix are versions, e.g. 'release-1.2.3', default only 'v' is allowed")
+	fs.StringVar(&o.opts.PreferTagType, `prefer-tag-type`, `any`, "tag type preferred when a commit has several tags: any (semantic version order), annotated, lightweight")
+	fs.BoolVar(&o.noCIBranch, `no-ci-branch`, false, "do not trust branch and tag from CI env vars, e.g. GITHUB_REF_NAME, CI_COMMIT_BRANCH, CI_COMMIT_TAG")
+	fs.StringVar(&o.namespaces, `tag-namespace`, ``, "comma separated namespaces under refs/tags, e.g. 'releases', only their tags are used and the namespace is removed from tag names")
+	fs.BoolVar(&o.opts.SignedOnly, `signed-only`, false, "only use annotated tags whose PGP signature verifies with -trusted-keys")
+	fs.StringVar(&o.trustedKeys, `trusted-keys`, ``, "armored PGP public keyring file to verify tag signatures, default $GV_KEYRING, 'gv -a' shows the signature of the tag")
+	fs.Var((*listFlag)(&o.opts.Paths), `path`, "only count commits modifying the path in repository, e.g. 'services/foo', for component version in monorepo, repeat for any of paths")
+	fs.Var((*listFlag)(&o.opts.Ignore), `ignore`, "gitignore style pattern of files whose changes do not modify -path, e.g. '*.md', repeatable")
+	fs.StringVar(&o.priority, `branch-priority`, ``, "comma separated glob patterns preferred in order if several branches contain HEAD, e.g. 'main,master,release/*,develop', the others follow by name")
+	fs.StringVar(&o.releases, `release-branches`, ``, "comma separated glob patterns of release branches, e.g. 'main,release/*', pseudo-versions of other branches get '-dev.<branch>'")
+	fs.StringVar(&o.channels, `channels`, strings.Join(version.DefaultChannels, `,`), "comma separated release channel rules 'name=pattern' matched in order, pattern is branch glob, '@tag' for tag at HEAD or '*' for any")
+	fs.BoolVar(&o.opts.ChannelInVersion, `channel-in-version`, false, "append release channel to prerelease of version, e.g. v1.2.3-rc")
+	fs.IntVar(&o.opts.BranchLength, `branch-length`, 40, "max length of sanitized branch embedded in version")
+	fs.IntVar(&o.opts.SubjectLength, `subject-length`, 72, "max characters of commit subject shown in 'gv -a'")
+	fs.BoolVar(&o.opts.Snapshot, `snapshot`, false, "show Maven version: tag at HEAD without 'v', or patch bumped nearliest tag with '-SNAPSHOT'")
+	fs.BoolVar(&o.opts.SnapshotUnique, `snapshot-unique`, false, "show Maven unique snapshot version, e.g. 1.5.0-20240607.123455-3, requires -snapshot")
+	fs.StringVar(&o.opts.VersionFile, `version-file`, ``, "file in repository, e.g. 'VERSION', whose version is the base of pseudo-version instead of v0.0.0 if no tag is reachable")
+	fs.StringVar(&o.opts.NotesRef, `notes-ref`, `refs/notes/gv`, "notes ref whose note of HEAD overrides version, set by 'gv note'")
+	fs.BoolVar(&o.opts.CheckModule, `check-module`, false, "fail if major version does not match go.mod module path suffix, e.g. v2.0.0 requires '/v2', 'gv -a' only warns")
+	fs.BoolVar(&o.opts.Module, `module`, false, "show pseudo-version in Go module format")
+	fs.BoolVar(&o.opts.Submodules, `submodules`, false, "list submodules in 'gv -a' with pinned and checked-out commit and version resolved in each submodule, print them as JSON array with -json")
+	fs.BoolVar(&o.useCache, `cache`, false, "cache version information in -cache-dir keyed by repository path, HEAD, all refs, config, modified worktree files and options, skipped with -dirty-untracked or -submodules")
+	fs.BoolVar(&o.noCache, `no-cache`, false, "do not use cache even if -cache is set, e.g. in "+repoConfigName)
+	fs.BoolVar(&o.cacheClear, `cache-clear`, false, "remove all cached version information in -cache-dir and exit")
+	fs.StringVar(&o.cacheDir, `cache-dir`, ``, "dir of -cache, default 'gv' in user cache dir, e.g. '~/.cache/gv'")
+	fs.BoolVar(&o.opts.DiffStat, `diffstat`, false, "count changed files, inserted and deleted lines between the nearliest tag and HEAD in 'gv -a', only under -path if it is set")
+	fs.BoolVar(&o.opts.Contributors, `contributors`, false, "count authors since the nearliest tag in 'gv -a', list them with commits count with -v, authors are mapped by .mailmap")
+	fs.StringVar(&o.opts.BuildNumber, `build-number`, `all`, "build number counts commits: all (reachable from HEAD), since-tag, or an explicit number used by -ci-build-meta outside CI")
+	fs.BoolVar(&o.ciBuildMeta, `ci-build-meta`, false, "append '+build.<N>' to version, N is build number of detected CI system, e.g. GITHUB_RUN_NUMBER, or explicit -build-number, nothing without both")
+	fs.IntVar(&o.opts.MaxDepth, `max-depth`, 0, "max commits to walk when counting commits, 0 means no limit")
+	fs.IntVar(&o.opts.MaxCommits, `max-commits`, 5_000_000, "max commits of any history walk, exit with code 17 beyond it instead of growing memory, 0 means no limit")
+	fs.IntVar(&o.opts.MaxTags, `max-tags`, 500_000, "max tags read, exit with code 17 beyond it, 0 means no limit")
+	fs.IntVar(&o.opts.MaxBranches, `max-branches`, 100_000, "max branches walked to find branch of detached HEAD, exit with code 17 beyond it, 0 means no limit")
+	fs.IntVar(&o.opts.Jobs, `jobs`, 0, "concurrent branch walks, 0 means GOMAXPROCS")
+	fs.IntVar(&o.discovery.Depth, `discovery-depth`, 1, "levels of sub dirs to search for .git dir without -r")
+	fs.StringVar(&o.discoveryExclude, `discovery-exclude`, ``, "comma separated patterns of sub dir names to skip when searching for .git dir, e.g. 'node_modules,vendor'")
+	fs.IntVar(&o.opts.CacheMB, `cache-mb`, 96, "object cache size in MiB, raise it for repositories with large packfiles")
+	fs.DurationVar(&o.timeout, `timeout`, 0, "timeout of the whole run: repository discovery, history walks and network operations of commands, e.g. 10s, 0 means no timeout")
+	fs.StringVar(&o.output, `o`, ``, "write version output to file instead of stdout")
+	fs.BoolVar(&o.teamcity, `teamcity`, false, "print TeamCity service messages to set build number and parameters")
+	fs.StringVar(&o.jenkinsProps, `jenkins-props`, ``, "write Java properties file of version information for Jenkins")
+	fs.StringVar(&o.jenkinsPrefix, `jenkins-prefix`, ``, "key prefix in Jenkins properties file, e.g. 'GV_'")
+	fs.BoolVar(&o.azdo, `azdo`, false, "print Azure DevOps logging commands to set pipeline variables")
+	fs.BoolVar(&o.azdoOutput, `azdo-output`, true, "set Azure DevOps variables as output variables (isOutput=true) for later jobs")
+	fs.BoolVar(&o.azdoBuild, `azdo-buildnumber`, false, "print Azure DevOps logging command to update build number to version")
+	fs.BoolVar(&o.gha, `gha`, false, "write version information to GitHub Actions step outputs in $GITHUB_OUTPUT")
+	fs.BoolVar(&o.ghaEnv, `gha-env`, false, "write version information as GV_ prefixed env vars to $GITHUB_ENV for later steps")
+	fs.StringVar(&o.dotenv, `dotenv`, ``, "write GV_ prefixed env vars to dotenv file, e.g. for GitLab CI dotenv report")
+	fs.StringVar(&o.ciMode, `ci`, ``, "CI integration output: auto (detect by env vars), "+strings.Join(ciSystems(), `, `))
+	fs.StringVar(&o.sbom, `sbom`, ``, "print SBOM component fragment in JSON: "+strings.Join(sbomFormats, `, `))
+	fs.BoolVar(&o.requireTag, `require-tag`, false, "exit with code 10 after printing version if no tag with -tag-prefix points at HEAD, e.g. 'gv -require-tag && make publish'")
+	fs.BoolVar(&o.requireMerged, `require-merged`, false, "exit with code 16 after printing version if HEAD is not reachable from origin/HEAD, or local main or master without it, also if none of them exists")
+	fs.BoolVar(&o.dockerTag, `docker-tag`, false, "convert version to valid Docker image tag, e.g. v1.5.0-feature-login.20240607-abcd")
+	fs.BoolVar(&o.allTags, `all-tags`, false, "show all tags at HEAD line by line, same as '-field Tags'")
+	fs.BoolVar(&o.reachable, `reachable`, false, "'gv verify' only requires the tag to be an ancestor of HEAD")
+	fs.BoolVar(&o.check, `check`, false, "'gv write-version' only checks the version file, exit with code 11 if it is out of date")
+	fs.BoolVar(&o.trimV, `trim-v`, false, "'gv write-version' writes version without 'v' prefix, e.g. 1.2.3")
+	fs.StringVar(&o.sortBy, `sort`, `version`, "sort releases of 'gv history' by: version, date")
+	fs.StringVar(&o.since, `since`, ``, "'gv check-order' only checks tags dated since the date, e.g. 2024-01-01")
+	fs.BoolVar(&o.jsonOut, `json`, false, "print 'gv history', 'gv check-order', 'gv check-module', -workspace or -submodules as JSON array, -a, 'gv autotag' or 'gv promote' result as JSON object")
+	fs.StringVar(&o.tagOpts.Remote, `remote`, `origin`, "remote 'gv autotag' and 'gv promote -push' push the tag to, empty to only tag locally")
+	fs.BoolVar(&o.push, `push`, false, "push tag created by 'gv promote' or 'gv bump' to -remote")
+	fs.BoolVar(&o.printOnly, `print-only`, false, "only print version of 'gv promote' or 'gv bump' without creating the tag")
+	fs.StringVar(&o.bumpOpts.To, `to`, ``, "explicit version 'gv bump' tags instead of bumping a level, e.g. v3.0.0, it must be higher than all version tags with -tag-prefix and match major version of go.mod module path")
+	fs.BoolVar(&o.bumpOpts.AllowDowngrade, `allow-downgrade`, false, "allow 'gv bump -to' version not higher than existing version tags, e.g. to renumber releases")
+	fs.StringVar(&o.bumpOpts.Prerelease, `pre`, ``, "prerelease series of 'gv bump', e.g. 'rc' for v1.9.0-rc.1, counting up from the highest existing tag of the series")
+	fs.StringVar(&o.tagBranch, `tag-branches`, strings.Join(version.DefaultTagBranches, `,`), "comma separated glob patterns of branches 'gv autotag' is allowed to tag")
+	fs.BoolVar(&o.workspace, `workspace`, false, "print module path, dir and version of each module in go.work of -r dir or current dir, each resolved in its own repository with its dir as tag prefix")
+	fs.StringVar(&o.field, `field`, ``, "only show single field: "+strings.Join(version.Fields, `, `))
+	fs.BoolVar(&o.raw, `raw`, false, "write output bytes as is for forensic use, by default invalid UTF-8 in tag names, messages and authors is replaced with U+FFFD and control characters except tab are removed, JSON is always valid UTF-8")
+	fs.StringVar(&o.format, `format`, ``, "show version information formatted by Go template, e.g. '{{.Version | trimv}}+{{.CommitID | short 7}}', see -help-format")
+	fs.StringVar(&o.filter, `exec-filter`, ``, "shell command printing the final version, it gets the version on stdin and all fields as GV_ prefixed env vars")
+	fs.DurationVar(&o.filterT, `exec-timeout`, time.Minute, "timeout of -exec-filter command, 0 means no timeout")
+	fs.Var((*listFlag)(&o.replace), `replace`, "sed style regexp substitution 's/pattern/replacement/' with optional 'g' flag applied to version before printing, e.g. 's/^v//', repeatable")
+	fs.BoolVar(&o.helpFmt, `help-format`, false, "show fields and functions of -format templates")
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintln(w, "Usage: gv [command|commit] [options]")
+		fmt.Fprintln(w, "Commands:")
+		fmt.Fprintln(w, "\t<commit>\tget version at full or abbreviated commit hash, same as -commit")
+		fmt.Fprintln(w, "\tchanged\tlist commits modifying -path since the nearliest tag, exit 8 if none")
+		fmt.Fprintln(w, "\tverify <version>\tcheck HEAD is the commit tagged with version, or descends from it with -reachable, exit 9 if not")
+		fmt.Fprintln(w, "\tnote set <version>|clear\toverride version of HEAD with note in -notes-ref, or remove the override")
+		fmt.Fprintln(w, "\twrite-version [file]\twrite version to file in worktree, default VERSION, only if it changes, or compare with -check")
+		fmt.Fprintln(w, "\thistory\tlist semantic version tags with -tag-prefix: tag, commit, date, annotated or lightweight, commits since previous release")
+		fmt.Fprintln(w, "\tcheck-order\tlist version tags with -tag-prefix descending from a higher version tag, exit 13 if any")
+		fmt.Fprintln(w, "\tautotag\ttag HEAD with next version from conventional commits since the nearliest tag and push it to -remote, nothing if HEAD is tagged or unchanged, exit 15 on branches not in -tag-branches or dirty worktree")
+		fmt.Fprintln(w, "\tpromote\ttag commit of prerelease tag at HEAD with its release version, e.g. v2.0.0 for v2.0.0-rc.3, push it with -push, exit 15 if HEAD has no prerelease tag or the release tag is on another commit")
+		fmt.Fprintln(w, "\tbump major|minor|patch\ttag HEAD with version bumped from the nearliest tag, next prerelease of series with -pre, push it with -push")
+		fmt.Fprintln(w, "\tbump -to <version>\ttag HEAD with version after checking it is higher than all version tags and matches go.mod module path, exit 15 if not")
+		fmt.Fprintln(w, "\tcheck-module\tlist version tags whose major does not match module path of go.mod, or nested module tags without '<dir>/' prefix, exit 14 if any")
+		fmt.Fprintln(w, "Options:")
+		fs.PrintDefaults()
+		fmt.Fprintln(w, "Example:")
+		fmt.Fprintln(w, "\tgv -r /path/to/repo/")
+		fmt.Fprintln(w, "\tgv -a -r /path/to/repo/")
+		fmt.Fprintln(w, "\tcd /path/to/repo/ && gv")
+		fmt.Fprintln(w, "\tcd /path/to/repo/ && gv -a")
+		fmt.Fprintln(w, "\tgv changed -path services/foo -tag-prefix foo/")
+	}
+	return fs
 }
 
-// read .git for version information
-func main() {
-	var gitRoot string
-	if len(repo) > 0 {
-		gitRoot = repo
-		if gitRoot != `` && filepath.Base(gitRoot) != `.git` {
-			gitRoot = filepath.Join(gitRoot, `.git`)
+// parseArgs parse args into fs, options may follow the command and its arguments, all args after '--' are arguments
+func (o *options) parseArgs(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for rest := args; fs.NArg() > 0; {
+		if n := len(rest) - fs.NArg(); n > 0 && rest[n-1] == `--` {
+			o.cmdArgs = append(o.cmdArgs, fs.Args()...)
+			break
+		}
+		o.cmdArgs = append(o.cmdArgs, fs.Arg(0))
+		rest = fs.Args()[1:]
+		if err := fs.Parse(rest); err != nil {
+			return err
 		}
-	} else {
-		gitRoot = getGitRoot()
 	}
-	if gitRoot == `` || filepath.Base(gitRoot) != `.git` {
-		slog.Error("can not find .git dir for repo", `path`, gitRoot)
-		return
+	if len(o.cmdArgs) > 0 {
+		o.command, o.cmdArgs = o.cmdArgs[0], o.cmdArgs[1:]
 	}
-	Version(gitRoot)
+	return nil
 }
 
-func getGitRoot() (gitRoot string) {
-	wd, err := os.Getwd()
-	if err != nil {
-		slog.Error("get current working dir", `err`, err)
-		return ``
+// read .git for version information
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run gv with command line args after the program name, write output to stdout and diagnostics to stderr,
+// and return the exit code, each run parses args into its own options, so runs may be concurrent
+func run(args []string, stdout, stderr io.Writer) int {
+	o := new(options)
+	fs := newFlagSet(o, stderr)
+	if err := o.parseArgs(fs, args); errors.Is(err, flag.ErrHelp) {
+		return 0
+	} else if err != nil {
+		return exitUsage // reported by fs with usage
 	}
-	wd, err = filepath.Abs(wd)
-	if err != nil {
-		slog.Error("get wd absolute path", `err`, err)
-		return ``
+	logger := o.newLogger(stderr)
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.logLvl)); err != nil {
+		logger.Error("invalid option", `err`, err)
+		return exitUsage
 	}
-	for range [3]struct{}{} { // recursive find '.git' dir from './' or '../' or '../../'
-		_ = filepath.Walk(wd, func(path string, info fs.FileInfo, err error) error {
-			if !info.IsDir() {
-				return nil
-			}
-			if filepath.Base(path) == `.git` {
-				gitRoot = path
-				return filepath.SkipAll
-			}
-			return nil
-		})
-		if gitRoot != `` {
-			break
+	if o.logFmt != `text` && o.logFmt != `json` {
+		logger.Error("invalid option", `err`, "invalid log format "+o.logFmt+", must be one of text, json")
+		return exitUsage
+	}
+	if o.helpFmt {
+		fmt.Fprint(stdout, formatHelp)
+		return 0
+	}
+	if o.cacheClear {
+		c, err := newResultCache(o.cacheDir, logger)
+		if err == nil {
+			err = c.clear()
+		}
+		if err != nil {
+			logger.Error("clear cache", `err`, err)
+			return exitError
+		}
+		return 0
+	}
+	for _, expr := range o.replace {
+		rule, err := parseReplacement(expr)
+		if err != nil {
+			logger.Error("invalid option", `err`, err)
+			return exitUsage
+		}
+		o.rules = append(o.rules, rule)
+	}
+	if o.format != `` {
+		if o.field != `` || o.allTags {
+			logger.Error("invalid option", `err`, "-format can not be used with -field or -all-tags")
+			return exitUsage
+		}
+		var err error
+		if o.tmpl, err = parseFormat(o.format, &o.opts.DateFormat); err != nil {
+			logger.Error("invalid option", `err`, fmt.Errorf("invalid format: %w", err))
+			return exitUsage
+		}
+	}
+	if o.command != `` && o.opts.Commit == `` && len(o.command) >= 4 && strings.Trim(o.command, `0123456789abcdefABCDEF`) == `` {
+		o.opts.Commit, o.command = o.command, `` // gv <hash>
+	}
+	if o.command != `` && !slices.Contains(commands, o.command) {
+		logger.Error("unknown command", `command`, o.command, `valid`, strings.Join(commands, `, `))
+		return exitUsage
+	}
+	if n := len(o.cmdArgs); o.command == `verify` && n != 1 ||
+		o.command == `note` && !(n == 2 && o.cmdArgs[0] == `set` || n == 1 && o.cmdArgs[0] == `clear`) ||
+		o.command == `write-version` && n > 1 ||
+		o.command == `bump` && (o.bumpOpts.To == ``) != (n == 1) ||
+		!slices.Contains([]string{`verify`, `note`, `write-version`, `bump`}, o.command) && n > 0 {
+		logger.Error("invalid arguments", `command`, o.command, `args`, o.cmdArgs)
+		return exitUsage
+	}
+	if o.command == `bump` && o.bumpOpts.To != `` && o.bumpOpts.Prerelease != `` {
+		logger.Error("invalid option", `err`, "-to can not be used with -pre")
+		return exitUsage
+	}
+	if o.command == `bump` && o.bumpOpts.To == `` {
+		var err error
+		if o.bumpOpts.Level, err = version.ParseLevel(o.cmdArgs[0]); err != nil {
+			logger.Error("invalid arguments", `command`, o.command, `err`, err)
+			return exitUsage
+		}
+		if _, err = version.ParseVersion(`0.0.0-` + o.bumpOpts.Prerelease + `.1`); o.bumpOpts.Prerelease != `` && err != nil {
+			logger.Error("invalid option", `err`, fmt.Errorf("invalid prerelease series %s: %w", o.bumpOpts.Prerelease, err))
+			return exitUsage
+		}
+	}
+	o.bumpOpts.DryRun = o.printOnly
+	if o.sortBy != `version` && o.sortBy != `date` {
+		logger.Error("invalid option", `err`, "sort must be one of version, date", `sort`, o.sortBy)
+		return exitUsage
+	}
+	var sinceDate time.Time
+	if o.since != `` {
+		var err error
+		if sinceDate, err = time.Parse(time.DateOnly, o.since); err != nil {
+			logger.Error("invalid option", `err`, fmt.Errorf("invalid since date: %w", err))
+			return exitUsage
+		}
+	}
+	if o.discoveryExclude != `` {
+		o.discovery.Exclude = strings.Split(o.discoveryExclude, `,`)
+	}
+	if err := o.discovery.Validate(); err != nil {
+		logger.Error("invalid option", `err`, err)
+		return exitUsage
+	}
+	// the timeout bounds the whole run from repository discovery on, including walks and network operations
+	ctx := context.Background()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	if o.repo != `` {
+		var err error
+		if o.repo, err = expandHome(o.repo); err != nil {
+			logger.Error("invalid option", `err`, err)
+			return exitUsage
+		}
+	}
+	gitRoot := o.repo
+	modPath := ``
+	if o.autoPrefix && !o.workspace {
+		dir := cmp.Or(o.repo, `.`)
+		var err error
+		if gitRoot, modPath, o.modDir, err = moduleRoot(dir); err != nil {
+			logger.Error("find git root", `path`, dir, `err`, err)
+			return exitNoRepository
+		}
+	} else if gitRoot == `` && !o.workspace { // modules of workspace are resolved in their own repositories
+		wd, err := os.Getwd()
+		if err != nil {
+			logger.Error("get current working dir", `err`, err)
+			return exitError
+		}
+		gitRoot, err = version.DiscoverGitRootContext(ctx, wd, o.discovery)
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Error("find git root", `path`, wd, `timeout`, o.timeout, `err`, err)
+			return exitTimeout
+		} else if err != nil {
+			logger.Error("find git root", `path`, wd, `err`, err)
+			return exitNoRepository
+		}
+	}
+	logger = o.newLogger(stderr).With(`repo`, gitRoot, `command`, cmp.Or(o.command, `version`))
+	if o.workspace && o.command != `` {
+		logger.Error("invalid option", `err`, "-workspace can not be used with command "+o.command)
+		return exitUsage
+	}
+	if o.workspace {
+		// modules of workspace are in their own repositories, no repository config applies to all of them
+	} else if err := loadRepoConfig(fs, gitRoot, logger); err != nil {
+		logger.Error("load "+repoConfigName, `err`, err)
+		return exitUsage
+	}
+	if o.modDir == `.` {
+		o.modDir = `` // root module has no tag prefix
+	}
+	if o.modDir != `` {
+		prefix := version.ModuleTagPrefix(modPath, o.modDir)
+		if o.opts.TagPrefix != `` && o.opts.TagPrefix != prefix {
+			logger.Warn("auto prefix replaces tag prefix", `prefix`, prefix, `tag-prefix`, o.opts.TagPrefix, `go.mod`, o.modDir)
+		}
+		o.opts.TagPrefix = prefix
+	}
+	if o.command == `changed` && len(o.opts.Paths) == 0 {
+		logger.Error("invalid option", `err`, "changed requires -path")
+		return exitUsage
+	}
+	if o.tagBranch != `` {
+		o.tagOpts.Branches = strings.Split(o.tagBranch, `,`)
+	}
+	if o.priority != `` {
+		o.opts.BranchPriority = strings.Split(o.priority, `,`)
+	}
+	if o.releases != `` {
+		o.opts.ReleaseBranches = strings.Split(o.releases, `,`)
+	}
+	if o.channels != `` {
+		o.opts.Channels = strings.Split(o.channels, `,`)
+	}
+	if !o.noCIBranch {
+		o.opts.CIBranch, o.opts.CITag, o.opts.CICommit = ciBranch(os.Getenv), ciTag(os.Getenv), ciCommit(os.Getenv)
+	}
+	if o.namespaces != `` {
+		o.opts.TagNamespaces = strings.Split(o.namespaces, `,`)
+	}
+	if o.trustedKeys == `` {
+		o.trustedKeys = os.Getenv(`GV_KEYRING`)
+	}
+	if o.trustedKeys != `` {
+		keyring, err := os.ReadFile(o.trustedKeys)
+		if err != nil {
+			logger.Error("read trusted keys", `path`, o.trustedKeys, `err`, err)
+			return exitUsage
+		}
+		o.opts.Keyring = string(keyring)
+	}
+	if o.ciBuildMeta {
+		number := ciBuildNumber(os.Getenv, logger)
+		if number == `` && strings.Trim(o.opts.BuildNumber, `0123456789`) == `` {
+			number = o.opts.BuildNumber
+		}
+		o.opts.BuildMetadata = buildMetadata(number)
+	}
+	if epoch := os.Getenv(`SOURCE_DATE_EPOCH`); epoch != `` {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			logger.Error("invalid SOURCE_DATE_EPOCH", `err`, err)
+			return exitUsage
+		}
+		o.opts.SourceDate = time.Unix(sec, 0).UTC()
+	}
+	if err := o.opts.Validate(); err != nil {
+		logger.Error("invalid option", `err`, err)
+		return exitUsage
+	}
+	if o.field != `` && !slices.Contains(version.Fields, o.field) {
+		logger.Error("unknown field", `field`, o.field, `valid`, strings.Join(version.Fields, `, `))
+		return exitUsage
+	}
+	if o.sbom != `` && !slices.Contains(sbomFormats, o.sbom) {
+		logger.Error("unknown SBOM format", `sbom`, o.sbom, `valid`, strings.Join(sbomFormats, `, `))
+		return exitUsage
+	}
+	if o.ciMode != `` {
+		system := o.ciMode
+		if system == `auto` {
+			system = detectCI(os.Getenv, logger)
+		}
+		if !o.enableCI(system) {
+			logger.Error("unknown CI system", `ci`, o.ciMode, `valid`, `auto, `+strings.Join(ciSystems(), `, `))
+			return exitUsage
+		}
+	}
+	if !o.raw {
+		stdout = printableWriter{stdout}
+	}
+	if o.workspace {
+		dir := cmp.Or(gitRoot, `.`)
+		if err := o.Workspace(ctx, stdout, stderr, dir); err != nil {
+			logger.Error("get versions of workspace modules", `path`, dir, `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `changed` {
+		if err := o.Changed(ctx, stdout, stderr, gitRoot); errors.Is(err, errUnchanged) {
+			logger.Info("no commit modifies paths since tag", `path`, o.opts.Paths, `err`, err)
+			return exitUnchanged
+		} else if err != nil {
+			logger.Error("find changed commits", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `write-version` {
+		name := `VERSION`
+		if len(o.cmdArgs) > 0 {
+			name = o.cmdArgs[0]
+		}
+		if err := o.WriteVersion(ctx, stdout, stderr, gitRoot, name); errors.Is(err, errStale) {
+			logger.Error("check version file", `path`, name, `err`, err)
+			return exitStale
+		} else if err != nil {
+			logger.Error("write version file", `path`, name, `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `note` {
+		var note string
+		if o.cmdArgs[0] == `set` {
+			note = o.cmdArgs[1]
+		}
+		if err := version.SetNote(gitRoot, note, o.opts); err != nil {
+			logger.Error("set version note", `ref`, o.opts.NotesRef, `err`, err)
+			return exitCode(err)
 		}
-		wd = filepath.Dir(wd)
+		return 0
 	}
-	return
+	if o.command == `verify` {
+		if err := o.Verify(ctx, stdout, stderr, gitRoot, o.cmdArgs[0]); errors.Is(err, version.ErrVersionMismatch) {
+			logger.Error("verify version", `version`, o.cmdArgs[0], `err`, err)
+			return exitMismatch
+		} else if err != nil {
+			logger.Error("verify version", `version`, o.cmdArgs[0], `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `check-order` {
+		if err := o.CheckOrder(ctx, stdout, stderr, gitRoot, sinceDate); errors.Is(err, version.ErrOutOfOrder) {
+			logger.Error("check order of version tags", `err`, err)
+			return exitOutOfOrder
+		} else if err != nil {
+			logger.Error("check order of version tags", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `autotag` {
+		if err := o.AutoTag(ctx, stdout, stderr, gitRoot); errors.Is(err, version.ErrBranchRefused) ||
+			errors.Is(err, version.ErrDirtyWorktree) || errors.Is(err, version.ErrTagExists) {
+			logger.Error("refuse to tag", `err`, err)
+			return exitRefused
+		} else if err != nil {
+			logger.Error("tag next version", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `promote` {
+		if err := o.Promote(ctx, stdout, stderr, gitRoot); errors.Is(err, version.ErrNoPrerelease) || errors.Is(err, version.ErrTagExists) {
+			logger.Error("refuse to promote", `err`, err)
+			return exitRefused
+		} else if err != nil {
+			logger.Error("promote prerelease", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `bump` {
+		if err := o.Bump(ctx, stdout, stderr, gitRoot); errors.Is(err, version.ErrTagExists) ||
+			errors.Is(err, version.ErrOutOfOrder) || errors.Is(err, version.ErrModuleMismatch) {
+			logger.Error("refuse to bump", `err`, err)
+			return exitRefused
+		} else if err != nil {
+			logger.Error("bump version", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `check-module` {
+		if err := o.CheckModule(ctx, stdout, stderr, gitRoot); errors.Is(err, version.ErrModuleMismatch) {
+			logger.Error("check version tags of modules", `err`, err)
+			return exitModuleMismatch
+		} else if err != nil {
+			logger.Error("check version tags of modules", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if o.command == `history` {
+		if err := o.History(ctx, stdout, stderr, gitRoot); err != nil {
+			logger.Error("get release history", `err`, err)
+			return exitCode(err)
+		}
+		return 0
+	}
+	if err := o.Version(ctx, stdout, stderr, gitRoot); err != nil {
+		logger.Error("get version", `err`, err)
+		return exitCode(err)
+	}
+	return 0
 }
 
-// Version get version at HEAD
-func Version(gitRoot string) {
-	tag, err := findTag(gitRoot)
+// errStale version file is out of date with -check
+var errStale = errors.New(`version file is out of date`)
+
+// WriteVersion write version line to file relative to worktree root, only if its content changes,
+// and report whether it is updated to stdout, or only compare with -check and return errStale if it differs
+func (o *options) WriteVersion(ctx context.Context, stdout, stderr io.Writer, gitRoot, name string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	v, err := version.Field(ctx, gitRoot, `Version`, opts)
 	if err != nil {
-		slog.Error(`find tag`, `err`, err)
-		return
+		return fmt.Errorf("get version: %w", err)
 	}
-	var version string
-	if tag != `` {
-		version = tag
-		fmt.Print(tag)
-		if !all {
-			return
-		}
+	if o.trimV {
+		v = strings.TrimPrefix(v, `v`)
 	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(version.WorktreeDir(gitRoot), name)
+	}
+	data := []byte(v + "\n")
+	old, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// a file checked out with CRLF line endings, e.g. by core.autocrlf on Windows, is up to date too
+	if bytes.Equal(bytes.ReplaceAll(old, []byte("\r\n"), []byte("\n")), data) {
+		_, err = fmt.Fprintf(stdout, "%s is up to date: %s\n", name, v)
+		return err
+	}
+	if o.check {
+		return fmt.Errorf("%w: %s has %q, want %q", errStale, name, bytes.TrimSpace(old), v)
+	}
+	if err = writeFileAtomic(name, data); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s is updated: %s\n", name, v)
+	return err
+}
 
-	line, err := getLastLineWithSeek(gitRoot)
+// errUntagged no tag at HEAD with -require-tag
+var errUntagged = errors.New(`no tag at HEAD`)
+
+// errNotMerged HEAD is not merged to default branch with -require-merged
+var errNotMerged = errors.New(`not merged to default branch`)
+
+// errUnchanged no commit modifies the paths since the tag
+var errUnchanged = errors.New(`unchanged`)
+
+// Changed write abbreviated hash and subject of commits modifying -path since the nearliest tag to stdout,
+// return errUnchanged if there is none
+func (o *options) Changed(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	tag, commits, err := version.Changed(ctx, gitRoot, opts)
 	if err != nil {
-		slog.Error("get last line", `err`, err)
-		return
+		return err
 	}
-	fields := strings.Split(line, ` `)
-	if l := len(fields); l < 6 {
-		slog.Error("get invalid commit record", `line`, line)
-		return
+	if len(commits) == 0 {
+		return fmt.Errorf("%w since tag %q", errUnchanged, tag)
+	}
+	var buf bytes.Buffer
+	for _, c := range commits {
+		fmt.Fprintf(&buf, "%s %s\n", c.ID[:min(cmp.Or(opts.Abbrev, version.DefaultAbbrev), len(c.ID))], c.Subject)
+	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
+
+// Verify check version matches HEAD, or is reachable from HEAD with -reachable,
+// write the tag on match, or diff-style explanation to stderr on mismatch
+func (o *options) Verify(ctx context.Context, stdout, stderr io.Writer, gitRoot, ver string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	v, err := version.Verify(ctx, gitRoot, ver, o.reachable, opts)
+	if errors.Is(err, version.ErrVersionMismatch) {
+		head := cmp.Or(opts.Ref, opts.Commit, `HEAD`)
+		fmt.Fprintf(stderr, "--- %s %s\n+++ %s %s\n%s\n", ver, cmp.Or(v.TagCommit, `(no tag)`), head, v.CommitID, v)
 	}
-	commitID, commitTime := fields[1], fields[4]
-	if len(commitID) < 40 || len(commitTime) < 10 {
-		slog.Error("get invalid commit ID/time", `commitID`, commitID, `commitTime`, commitTime)
-		return
+	if err != nil {
+		return err
 	}
-	branch, err := matchBranch(gitRoot, commitID)
+	_, err = fmt.Fprintln(stdout, v)
+	return err
+}
+
+// History write semantic version tags to stdout, one per line with tag, commit, date,
+// annotated or lightweight, and commits count since the previous release, or as JSON array with -json
+func (o *options) History(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	releases, err := version.History(ctx, gitRoot, o.sortBy == `date`, opts)
 	if err != nil {
-		slog.Error("match branch", `err`, err)
-		return
+		return err
 	}
-	if branch == `` {
-		branch, err = findBranch(gitRoot)
-		if err != nil {
-			slog.Error("find branch", `err`, err)
-			return
+	var buf bytes.Buffer
+	if o.jsonOut {
+		if releases == nil {
+			releases = []version.Release{}
+		}
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if err = enc.Encode(releases); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range releases {
+			kind := `lightweight`
+			if r.Annotated {
+				kind = `annotated`
+			}
+			fmt.Fprintf(&buf, "%s %s %s %s %d\n", r.Tag, r.CommitID[:min(cmp.Or(opts.Abbrev, version.DefaultAbbrev), len(r.CommitID))], r.Date, kind, r.Commits)
 		}
 	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
 
-	var ref string
-	tag, err = nearliestTag(gitRoot, branch)
-	if err == nil && tag != `` {
-		ref = tag
-	} else if showb {
-		ref = branch
+// CheckOrder write version tags descending from a tag of higher version to stdout, one per line,
+// or as JSON array with -json, return version.ErrOutOfOrder if any
+func (o *options) CheckOrder(ctx context.Context, stdout, stderr io.Writer, gitRoot string, since time.Time) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	violations, err := version.CheckOrder(ctx, gitRoot, since, opts)
+	if err != nil && !errors.Is(err, version.ErrOutOfOrder) {
+		return err
+	}
+	var buf bytes.Buffer
+	if o.jsonOut {
+		if violations == nil {
+			violations = []version.OrderViolation{}
+		}
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if e := enc.Encode(violations); e != nil {
+			return e
+		}
 	} else {
-		ref = `v0.0.0`
+		for _, v := range violations {
+			fmt.Fprintln(&buf, v)
+		}
+	}
+	if _, e := buf.WriteTo(stdout); e != nil {
+		return e
 	}
+	return err
+}
 
-	timestamp, err := strconv.ParseInt(commitTime, 10, 64)
+// AutoTag tag HEAD with the next version and push it, report the tag or why nothing is tagged to stdout,
+// or the result as JSON object with -json
+func (o *options) AutoTag(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	res, err := version.AutoTag(ctx, gitRoot, o.tagOpts, opts)
 	if err != nil {
-		slog.Error("parse commit time", `err`, err)
-		return
+		return err
 	}
-	date := time.Unix(timestamp, 0).Format(`20060102150405`)
-	if version == `` {
-		version = fmt.Sprintf("%s-%s-%s", ref, date, commitID[:12])
+	var buf bytes.Buffer
+	switch {
+	case o.jsonOut:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if err = enc.Encode(res); err != nil {
+			return err
+		}
+	case res.Reason != ``:
+		fmt.Fprintln(&buf, strings.TrimSpace(res.Reason+` `+res.Tag))
+	default:
+		fmt.Fprintf(&buf, "created %s (%s, %d commits since %s)", res.Tag, res.Level, res.Commits, cmp.Or(res.Previous, `start`))
+		if res.Pushed {
+			fmt.Fprintf(&buf, ", pushed to %s", o.tagOpts.Remote)
+		}
+		fmt.Fprintln(&buf)
 	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
 
-	if all {
-		fmt.Println(`Version: ` + version)
-		fmt.Println(`Tag: ` + tag)
-		fmt.Println(`Branch: ` + branch)
-		fmt.Println(`CommitTime: ` + date)
-		fmt.Println(`CommitID: ` + commitID)
-	} else {
-		fmt.Print(version)
+// Promote tag HEAD with release version of its prerelease tag, report the tag to stdout, only the release version
+// with -print-only, or the result as JSON object with -json
+func (o *options) Promote(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	to := o.tagOpts
+	if !o.push {
+		to.Remote = ``
 	}
+	res, err := version.Promote(ctx, gitRoot, to, o.printOnly, opts)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	switch {
+	case o.jsonOut:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if err = enc.Encode(res); err != nil {
+			return err
+		}
+	case o.printOnly:
+		fmt.Fprintln(&buf, strings.TrimPrefix(res.Tag, opts.TagPrefix))
+	case res.Reason != ``:
+		fmt.Fprintln(&buf, res.Reason+` `+res.Tag)
+	default:
+		fmt.Fprintf(&buf, "created %s from %s", res.Tag, res.Previous)
+		if res.Pushed {
+			fmt.Fprintf(&buf, ", pushed to %s", to.Remote)
+		}
+		fmt.Fprintln(&buf)
+	}
+	_, err = buf.WriteTo(stdout)
+	return err
 }
 
-func getLastLineWithSeek(gitRoot string) (string, error) {
-	file, err := os.Open(filepath.Join(gitRoot, `logs/HEAD`))
+// Bump tag HEAD with bumped version, report the tag to stdout, only the version with -print-only,
+// or the result as JSON object with -json
+func (o *options) Bump(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	to := o.tagOpts
+	if !o.push {
+		to.Remote = ``
+	}
+	res, err := version.Bump(ctx, gitRoot, o.bumpOpts, to, opts)
 	if err != nil {
-		return "", fmt.Errorf("os open file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	var line []byte
-	stat, _ := file.Stat()
-	fileSize := stat.Size()
-	// read file byte by byte with reverse order until the head of last line
-	for cursor := int64(-1); cursor > -fileSize; cursor-- {
-		_, err = file.Seek(cursor, io.SeekEnd)
-		if err != nil {
-			return "", fmt.Errorf("file seek to %d: %w", cursor, err)
+	var buf bytes.Buffer
+	switch {
+	case o.jsonOut:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if err = enc.Encode(res); err != nil {
+			return err
+		}
+	case o.printOnly:
+		fmt.Fprintln(&buf, strings.TrimPrefix(res.Tag, opts.TagPrefix))
+	default:
+		if o.bumpOpts.To != `` {
+			fmt.Fprintf(&buf, "created %s", res.Tag)
+		} else {
+			fmt.Fprintf(&buf, "created %s (%s from %s)", res.Tag, res.Level, cmp.Or(res.Previous, `start`))
 		}
+		if res.Pushed {
+			fmt.Fprintf(&buf, ", pushed to %s", to.Remote)
+		}
+		fmt.Fprintln(&buf)
+	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
 
-		char := make([]byte, 1)
-		count, err := file.Read(char)
-		if err != nil {
-			return "", fmt.Errorf("read 1 byte from file: %w", err)
+// CheckModule write version tags breaking Go module versioning to stdout, one per line,
+// or as JSON array with -json, return version.ErrModuleMismatch if any
+func (o *options) CheckModule(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot)
+	problems, err := version.CheckModules(ctx, gitRoot, opts)
+	if err != nil && !errors.Is(err, version.ErrModuleMismatch) {
+		return err
+	}
+	var buf bytes.Buffer
+	if o.jsonOut {
+		if problems == nil {
+			problems = []version.ModuleProblem{}
 		}
-		if count != 1 {
-			continue
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if e := enc.Encode(problems); e != nil {
+			return e
 		}
-		if cursor != -1 && (char[0] == 10 || char[0] == 13) {
-			break
+	} else {
+		for _, p := range problems {
+			fmt.Fprintln(&buf, p)
 		}
-
-		line = append(line, char...)
 	}
-
-	// reverse line content
-	for l, r := 0, len(line)-1; l < r; l, r = l+1, r-1 {
-		line[l], line[r] = line[r], line[l]
+	if _, e := buf.WriteTo(stdout); e != nil {
+		return e
 	}
-
-	return string(line), nil
+	return err
 }
 
-// findTag get tag at HEAD if it exists
-func findTag(gitRoot string) (tag string, err error) {
-	repo, err := git.PlainOpen(gitRoot)
-	if err != nil {
-		err = fmt.Errorf("git open repository path %s: %w", filepath.Dir(gitRoot), err)
-		return
+// exitCode map error to exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, version.ErrLimitExceeded):
+		return exitLimit
+	case errors.Is(err, version.ErrNoRepository):
+		return exitNoRepository
+	case errors.Is(err, version.ErrEmptyRepository):
+		return exitEmptyRepository
+	case errors.Is(err, version.ErrDetachedHead):
+		return exitDetachedHead
+	case errors.Is(err, version.ErrShallowHistory):
+		return exitShallowHistory
+	case errors.Is(err, version.ErrPartialClone):
+		return exitPartialClone
+	case errors.Is(err, version.ErrNoBranchFound):
+		return exitNoBranchFound
+	case errors.Is(err, errUntagged):
+		return exitUntagged
+	case errors.Is(err, errNotMerged):
+		return exitNotMerged
 	}
-	h, err := repo.Head()
-	if err != nil {
-		err = fmt.Errorf("get repository head: %w", err)
-		return
+	return exitError
+}
+
+// now get current time, or fixed SOURCE_DATE_EPOCH time for reproducible builds
+func (o *options) now() time.Time {
+	if !o.opts.SourceDate.IsZero() {
+		return o.opts.SourceDate
 	}
-	tags, err := repo.Tags()
-	if err != nil {
-		err = fmt.Errorf("get repository tags: %w", err)
-		return
-	}
-	err = tags.ForEach(func(reference *plumbing.Reference) error {
-		if reference.Hash() == h.Hash() {
-			tag = reference.Name().Short()
-
-			return storer.ErrStop
-		}
-		return nil
-	})
-	return
-
-	// fallback to run git command
-	//	1: git tag --points-at HEAD
-	//	2: git pack-refs; awk -F 'tags/' /$(git rev-parse HEAD)/'{print $2}' .git/packed-refs
-	//err = os.Chdir(filepath.Dir(gitRoot))
-	//if err != nil {
-	//	slog.Error("change dir", `err`, err)
-	//	return
-	//}
-	//cmd := exec.Command(`sh`, `-c`, `git tag --points-at HEAD 2> /dev/null | sort -V | tail -1`)
-	//output, err := cmd.Output()
-	//if err != nil {
-	//	slog.Error("git cmd output", `err`, err)
-	//	return
-	//}
-	//tag = string(output)
+	return time.Now()
 }
 
-// nearliestTag find the nearliest tag from given branch
-func nearliestTag(gitRoot, branch string) (tag string, err error) {
-	repo, err := git.PlainOpen(gitRoot)
-	if err != nil {
-		err = fmt.Errorf("git open repository path %s: %w", filepath.Dir(gitRoot), err)
-		return
+// newLogger create logger writing diagnostics to w in -log-format from -log-level, debug logs are written with -v
+func (o *options) newLogger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(o.logLvl)) // checked in run
+	if o.verbose {
+		level = slog.LevelDebug
 	}
-	h, err := repo.Head()
-	if err != nil {
-		err = fmt.Errorf("get repository head: %w", err)
-		return
+	options := &slog.HandlerOptions{Level: level}
+	if o.logFmt == `json` {
+		return slog.New(slog.NewJSONHandler(w, options))
 	}
-	branches, err := repo.Branches()
-	if err != nil {
-		err = fmt.Errorf("get branches: %w", err)
-		return
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// Version write version at HEAD to stdout or the output file, CI integration messages to stdout,
+// and diagnostics to stderr, stdout is written only after everything succeeds, so it never has partial output
+func (o *options) Version(ctx context.Context, stdout, stderr io.Writer, gitRoot string) error {
+	logger := o.newLogger(stderr).With(`repo`, gitRoot)
+	opts := o.opts
+	opts.Logger = logger
+	name := o.field
+	if name == `` && o.allTags {
+		name = `Tags`
 	}
-	tags, err := repo.Tags()
-	if err != nil {
-		err = fmt.Errorf("get repository tags: %w", err)
-		return
+	subList := opts.Submodules && o.jsonOut && o.field == `` && o.tmpl == nil && !o.all
+	if name == `` && !o.all && o.tmpl == nil && !subList {
+		name = `Version`
 	}
-	err = branches.ForEach(func(reference *plumbing.Reference) error {
-		commits, err := repo.Log(&git.LogOptions{From: reference.Hash()})
+	messages := o.teamcity || o.azdo || o.sbom != `` // CI messages and SBOM take stdout
+	integrate := messages || o.jenkinsProps != `` || o.gha || o.ghaEnv || o.dotenv != ``
+
+	var buf bytes.Buffer
+	var info version.Info
+	var partial error // timeout or limit exceeded after the version is resolved, the partial result is printed before exit with it
+	cached := o.useCache && !o.noCache
+	if name != `` && !integrate && !o.requireTag && !o.requireMerged && o.filter == `` && !cached {
+		value, err := version.Field(ctx, gitRoot, name, opts)
 		if err != nil {
-			return err
+			return fmt.Errorf("get field %s: %w", name, err)
 		}
-		if err = commits.ForEach(func(commit *object.Commit) error {
-			if commit.Hash == h.Hash() {
-				branch = reference.Name().Short()
-				return storer.ErrStop
-			}
-			return nil
-		}); err != nil || branch == `` {
-			return err
+		if o.dockerTag && name == `Version` {
+			value = version.DockerTag(value)
 		}
-		var tagRefs []*plumbing.Reference
-		if err = tags.ForEach(func(reference *plumbing.Reference) error {
-			tagRefs = append(tagRefs, reference)
-			return nil
-		}); err != nil || len(tagRefs) == 0 {
-			return err
+		if name == `Version` {
+			value = o.replaceVersion(value)
+		}
+		buf.WriteString(value)
+	} else {
+		var err error
+		opts.Fields = o.describeFields(name, subList, cached)
+		if cached {
+			var c *resultCache
+			if c, err = newResultCache(o.cacheDir, logger); err != nil {
+				return fmt.Errorf("open cache: %w", err)
+			}
+			info, err = c.describe(ctx, gitRoot, opts)
+		} else {
+			info, err = version.Describe(ctx, gitRoot, opts)
 		}
-		slices.Reverse(tagRefs)
-		for _, ref := range tagRefs {
-			if err = commits.ForEach(func(commit *object.Commit) error {
-				if ref.Hash() == commit.Hash {
-					tag = ref.Name().Short()
-					return storer.ErrStop
+		if (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, version.ErrLimitExceeded)) && info.Version != `` {
+			var empty []string
+			for _, name := range version.Fields {
+				if info.Get(name) == `` && (opts.Fields == nil || slices.Contains(opts.Fields, name)) {
+					empty = append(empty, name)
 				}
-				return nil
-			}); err == nil && tag != `` {
-				break
 			}
+			logger.Warn("describe version stopped early, show partial result", `empty`, strings.Join(empty, `,`), `timeout`, o.timeout, `err`, err)
+			partial = err
+		} else if err != nil {
+			return fmt.Errorf("describe version: %w", err)
 		}
-		if tag != `` {
-			return storer.ErrStop
+		if o.filter != `` {
+			if info.Version, err = runExecFilter(ctx, stderr, o.filter, o.filterT, info); err != nil {
+				return fmt.Errorf("exec filter: %w", err)
+			}
 		}
-		return nil
-	})
-	return
-}
+		if o.dockerTag {
+			info.Version = version.DockerTag(info.Version)
+		}
+		info.Version = o.replaceVersion(info.Version)
+		switch {
+		case subList:
+			if info.Submodules == nil {
+				info.Submodules = []version.Submodule{}
+			}
+			enc := json.NewEncoder(&buf)
+			enc.SetIndent(``, `  `)
+			if err = enc.Encode(info.Submodules); err != nil {
+				return err
+			}
+		case o.all && o.jsonOut && o.tmpl == nil:
+			enc := json.NewEncoder(&buf)
+			enc.SetIndent(``, `  `)
+			enc.SetEscapeHTML(false) // keep '<email>' of Author readable
+			if err = enc.Encode(info); err != nil {
+				return err
+			}
+		case o.tmpl != nil:
+			if err = o.tmpl.Execute(&buf, info); err != nil {
+				return fmt.Errorf("execute format: %w", err)
+			}
+		case name != ``:
+			buf.WriteString(info.Get(name))
+		default:
+			o.render(&buf, info)
+		}
+	}
 
-// matchBranch match branch by HEAD commit ID
-func matchBranch(gitRoot, commitID string) (branch string, err error) {
-	var content []byte
-	err = filepath.Walk(filepath.Join(gitRoot, `refs/heads`), func(path string, info fs.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
+	var msgs bytes.Buffer
+	if o.teamcity {
+		if err := writeTeamCity(&msgs, info); err != nil {
+			return fmt.Errorf("write TeamCity messages: %w", err)
 		}
-		content, err = os.ReadFile(path)
-		if err != nil {
-			err = fmt.Errorf("read file %s: %w", path, err)
-			return err
+	}
+	if o.azdo {
+		if err := writeAzureDevOps(&msgs, info, o.azdoOutput, o.azdoBuild); err != nil {
+			return fmt.Errorf("write Azure DevOps commands: %w", err)
 		}
-		if bytes.Contains(content, []byte(commitID)) {
-			branch = filepath.Base(path)
+	}
+	if o.sbom != `` {
+		if err := writeSBOM(&msgs, o.sbom, gitRoot, info, o.now()); err != nil {
+			return fmt.Errorf("write SBOM fragment: %w", err)
 		}
-		return nil
-	})
-	if branch == `` {
-		content, err = os.ReadFile(filepath.Join(gitRoot, `HEAD`))
-		if err != nil {
-			err = fmt.Errorf("read file: %w", err)
-			return "", err
+	}
+	if o.gha {
+		if err := writeGitHub(`GITHUB_OUTPUT`, info, ``, false); err != nil {
+			return fmt.Errorf("write GitHub Actions outputs: %w", err)
 		}
-
-		fields := bytes.Split(bytes.TrimSpace(content), []byte{'/'})
-		if l := len(fields); l >= 3 {
-			branch = string(fields[l-1])
+	}
+	if o.ghaEnv {
+		if err := writeGitHub(`GITHUB_ENV`, info, `GV_`, true); err != nil {
+			return fmt.Errorf("write GitHub Actions env: %w", err)
 		}
 	}
-	return
+	if o.dotenv != `` {
+		if err := writeFileAtomic(o.dotenv, dotenvVars(info)); err != nil {
+			return fmt.Errorf("write dotenv file: %w", err)
+		}
+	}
+	if o.jenkinsProps != `` {
+		if err := writeFileAtomic(o.jenkinsProps, jenkinsProperties(info, o.jenkinsPrefix)); err != nil {
+			return fmt.Errorf("write Jenkins properties file: %w", err)
+		}
+	}
+	if o.output != `` {
+		data := buf.Bytes()
+		if !o.raw {
+			data = printable(data)
+		}
+		if err := writeFileAtomic(o.output, data); err != nil {
+			return fmt.Errorf("write output file: %w", err)
+		}
+	} else if !messages {
+		if _, err := buf.WriteTo(stdout); err != nil {
+			return err
+		}
+	}
+	if _, err := msgs.WriteTo(stdout); err != nil {
+		return err
+	}
+	if partial != nil {
+		return fmt.Errorf("partial result: %w", partial)
+	}
+	if o.requireTag && len(info.Tags) == 0 {
+		return fmt.Errorf("%w: commit %s", errUntagged, info.CommitID)
+	}
+	if o.requireMerged && info.MergedToDefault != `true` {
+		return fmt.Errorf("%w: commit %s (%s)", errNotMerged, info.CommitID, info.MergedToDefault)
+	}
+	return nil
 }
 
-// findBranch get branch where the HEAD belongs to.
-func findBranch(gitRoot string) (branch string, err error) {
-	repo, err := git.PlainOpen(gitRoot)
-	if err != nil {
-		err = fmt.Errorf("git open repository path %s: %w", filepath.Dir(gitRoot), err)
-		return
+// describeFields names in version.Fields which the output and integrations read, nil for all of them,
+// e.g. only Commits for '-field Commits -require-tag', so Describe skips the history walks of the others
+func (o *options) describeFields(name string, subList, cached bool) []string {
+	if o.all || o.filter != `` || cached || o.azdo || o.gha || o.ghaEnv || o.dotenv != `` {
+		return nil // all fields are rendered, passed to the filter, cached or exported
 	}
-	h, err := repo.Head()
-	if err != nil {
-		err = fmt.Errorf("get repository head: %w", err)
-		return
+	fields := []string{`Version`}
+	switch {
+	case subList:
+	case o.tmpl != nil:
+		names, ok := templateFields(o.tmpl)
+		if !ok {
+			return nil
+		}
+		fields = append(fields, names...)
+	case name != ``:
+		fields = append(fields, name)
 	}
-	branches, err := repo.Branches()
-	if err != nil {
-		err = fmt.Errorf("get branches: %w", err)
-		return
+	if o.teamcity || o.jenkinsProps != `` {
+		fields = append(fields, `Tag`, `Branch`, `CommitID`, `CommitTime`)
+	}
+	if o.requireMerged {
+		fields = append(fields, `MergedToDefault`)
+	}
+	return fields
+}
+
+// expandHome expand leading '~' or '~user' of path to the home dir like shell does,
+// since some CI runners pass it literally, e.g. '~/work/project', other paths and unknown users are kept as is
+func expandHome(p string) (string, error) {
+	if !strings.HasPrefix(p, `~`) {
+		return p, nil
+	}
+	name, rest := p[1:], ``
+	if i := strings.IndexAny(name, `/`+string(filepath.Separator)); i >= 0 {
+		name, rest = name[:i], name[i:]
 	}
-	err = branches.ForEach(func(reference *plumbing.Reference) error {
-		commits, err := repo.Log(&git.LogOptions{From: reference.Hash()})
+	if name != `` {
+		u, err := user.Lookup(name)
 		if err != nil {
-			return err
+			return p, nil
 		}
-		err = commits.ForEach(func(commit *object.Commit) error {
-			if commit.Hash == h.Hash() {
-				branch = reference.Name().Short()
-				return storer.ErrStop
+		return u.HomeDir + rest, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ``, fmt.Errorf("expand %s: %w", p, err)
+	}
+	return home + rest, nil
+}
+
+// replaceVersion apply -replace substitutions to version in order
+func (o *options) replaceVersion(v string) string {
+	for _, rule := range o.rules {
+		v = rule.apply(v)
+	}
+	return v
+}
+
+// render write all version information to buf
+func (o *options) render(buf *bytes.Buffer, info version.Info) {
+	fmt.Fprintln(buf, `Version: `+info.Version)
+	fmt.Fprintln(buf, `Tag: `+info.Tag)
+	fmt.Fprintln(buf, `Tags: `+strings.Join(info.Tags, `, `))
+	switch {
+	case o.modDir != ``:
+		fmt.Fprintln(buf, `TagPrefix: `+o.opts.TagPrefix+` (from `+o.modDir+`/go.mod)`)
+	case o.autoPrefix:
+		fmt.Fprintln(buf, `TagPrefix: `+o.opts.TagPrefix+` (no nested go.mod)`)
+	}
+	if info.Tagger != `` {
+		fmt.Fprintln(buf, `Tagger: `+info.Tagger)
+		fmt.Fprintln(buf, `TagDate: `+info.TagDate)
+		fmt.Fprintln(buf, `SinceRelease: `+info.SinceRelease)
+	}
+	if info.Signed != `` {
+		fmt.Fprintln(buf, `Signed: `+info.Signed)
+		fmt.Fprintln(buf, `Signature: `+info.Signature)
+	}
+	switch {
+	case info.BranchSource == `ci`:
+		fmt.Fprintln(buf, `Branch: `+info.Branch+` (from CI env)`)
+	case info.BranchSource == `reflog` && o.verbose:
+		fmt.Fprintln(buf, `Branch: `+info.Branch+` (reflog)`)
+	default:
+		fmt.Fprintln(buf, `Branch: `+info.Branch)
+	}
+	fmt.Fprintln(buf, `Repo: `+info.Repo)
+	if info.RepoURL != `` {
+		fmt.Fprintln(buf, `RepoURL: `+info.RepoURL)
+	}
+	if info.ReleaseBranch != `` {
+		fmt.Fprintln(buf, `ReleaseBranch: `+info.ReleaseBranch)
+	}
+	fmt.Fprintln(buf, `MergedToDefault: `+info.MergedToDefault)
+	fmt.Fprintln(buf, `Channel: `+info.Channel)
+	fmt.Fprintln(buf, `CommitTime: `+info.CommitTime)
+	fmt.Fprintln(buf, `AuthorTime: `+info.AuthorTime)
+	fmt.Fprintln(buf, `Author: `+info.Author)
+	fmt.Fprintln(buf, `Committer: `+info.Committer)
+	fmt.Fprintln(buf, `Subject: `+info.Subject)
+	if info.Ref != `` {
+		fmt.Fprintln(buf, `Ref: `+info.Ref)
+	}
+	fmt.Fprintln(buf, `CommitID: `+info.CommitID)
+	fmt.Fprintln(buf, `TreeHash: `+info.TreeHash)
+	if info.Describe != `` {
+		fmt.Fprintln(buf, `Describe: `+info.Describe)
+	}
+	fmt.Fprintln(buf, `BuildNumber: `+info.BuildNumber)
+	if info.Contributors != `` {
+		fmt.Fprintln(buf, `Contributors: `+info.Contributors)
+		for _, a := range info.Authors {
+			if !o.verbose {
+				break
 			}
-			return nil
-		})
-		if branch != `` {
-			return storer.ErrStop
+			fmt.Fprintf(buf, "  %d %s <%s>\n", a.Commits, a.Name, a.Email)
 		}
-		return err
-	})
-	return
+	}
+	if info.DiffStat != nil {
+		fmt.Fprintln(buf, `ChangedFiles: `+info.DiffStat.String())
+	}
+	if info.Commits != `` {
+		fmt.Fprintln(buf, `Commits: `+info.Commits)
+		fmt.Fprintln(buf, `FirstCommit: `+info.FirstCommit)
+		fmt.Fprintln(buf, `RepoAge: `+info.RepoAge)
+	}
+	if info.Source != `` {
+		fmt.Fprintln(buf, `Source: `+info.Source)
+	}
+	for _, s := range info.Submodules {
+		fmt.Fprintln(buf, strings.TrimRight(fmt.Sprintf("Submodule: %s %s %s %s", s.Path, s.Status, s.Commit[:min(cmp.Or(o.opts.Abbrev, version.DefaultAbbrev), len(s.Commit))], s.Version), ` `))
+	}
 }
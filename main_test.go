@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/yougg/gv/pkg/version"
+)
+
+// testRepo repository in a temporary dir with a commit tagged v1.0.0 and an untagged commit on top if untagged
+func testRepo(t *testing.T, untagged bool) string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(`main`))); err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2024, 6, 7, 12, 34, 55, 0, time.UTC)
+	commit := func(content string) plumbing.Hash {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, `VERSION`), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(`VERSION`); err != nil {
+			t.Fatal(err)
+		}
+		when = when.Add(time.Hour)
+		sig := &object.Signature{Name: `gv`, Email: `gv@example.com`, When: when}
+		hash, err := wt.Commit(`release `+content, &git.CommitOptions{Author: sig, Committer: sig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	commit(`0.1.0`)
+	if _, err = repo.CreateTag(`v1.0.0`, commit(`1.0.0`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if untagged {
+		commit(`1.0.1`)
+	}
+	return dir
+}
+
+// amendPeople replace HEAD commit of repository in dir with one of the same tree by another author and committer
+func amendPeople(t *testing.T, dir, author, committer string) {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []struct {
+		sig  *object.Signature
+		name string
+	}{{&commit.Author, author}, {&commit.Committer, committer}} {
+		name, email, _ := strings.Cut(strings.TrimSuffix(p.name, `>`), ` <`)
+		p.sig.Name, p.sig.Email = name, email
+	}
+	commit.Committer.When = commit.Committer.When.Add(time.Minute)
+	obj := repo.Storer.NewEncodedObject()
+	if err = commit.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runOutput run gv with args and return exit code and stdout
+func runOutput(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{`-no-ci-branch`}, args...), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("gv %s: %s", strings.Join(args, ` `), stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestRun(t *testing.T) {
+	tagged, untagged, people := testRepo(t, false), testRepo(t, true), testRepo(t, true)
+	amendPeople(t, people, `Alice <alice@example.com>`, `Bob <bob@example.com>`)
+	const author, committer = `Author: Alice <alice@example.com>`, `Committer: Bob <bob@example.com>`
+	for _, tt := range []struct {
+		args     []string
+		code     int
+		want     string // stdout
+		contains string // in stdout
+	}{
+		{args: []string{`-r`, tagged}, want: `v1.0.0`},
+		{args: []string{`-r`, tagged, `-field`, `Tag`}, want: `v1.0.0`},
+		{args: []string{`-r`, tagged, `-format`, `{{.Version | trimv}} {{.CommitTime | date "2006-01-02"}}`}, want: `1.0.0 2024-06-07`},
+		{args: []string{`-r`, tagged, `-format`, `{{.CommitTime | date "15:04"}}`, `-date-format`, `rfc3339`}, want: `14:34`},
+		{args: []string{`-r`, tagged, `-replace`, `s/^v//`}, want: `1.0.0`},
+		{args: []string{`-r`, tagged, `-max-commits`, `1`, `-format`, `{{.Version}} {{.Branch}}`}, want: `v1.0.0 main`},
+		{args: []string{`-r`, tagged, `-max-commits`, `1`, `-require-tag`, `-teamcity`}, want: `##teamcity[buildNumber 'v1.0.0']`},
+		{args: []string{`-r`, tagged, `-max-commits`, `1`, `-format`, `{{.Get "Commits"}}`}, code: exitLimit},
+		{args: []string{`-r`, tagged, `-max-commits`, `1`, `-a`}, code: exitLimit},
+		{args: []string{`-r`, tagged, `-require-tag`}, want: `v1.0.0`},
+		{args: []string{`-r`, untagged}, want: `v1.0.0-20240607153455-`},
+		{args: []string{`-r`, untagged, `-require-tag`}, code: exitUntagged, want: `v1.0.0-20240607153455-`},
+		{args: []string{`-r`, untagged, `-b`, `-field`, `Branch`}, want: `main`},
+		{args: []string{`-r`, tagged, `verify`, `v1.0.0`}, want: `HEAD is at v1.0.0`},
+		{args: []string{`-r`, untagged, `verify`, `v1.0.0`}, code: exitMismatch},
+		{args: []string{`verify`, `-r`, untagged, `-reachable`, `v1.0.0`}, want: `HEAD is 1 commits ahead of v1.0.0`},
+		{args: []string{`-r`, tagged, `history`}, want: `v1.0.0 `},
+		{args: []string{`-r`, filepath.Join(t.TempDir(), `missing`)}, code: exitNoRepository},
+		{args: []string{`-r`, tagged, `unknown`}, code: exitUsage},
+		{args: []string{`-r`, tagged, `-sort`, `size`, `history`}, code: exitUsage},
+		{args: []string{`-no-such-flag`}, code: exitUsage},
+		{args: []string{`-help-format`}, want: `-format takes a Go text/template`},
+		{args: []string{`-r`, people, `-field`, `Author`}, want: `Alice <alice@example.com>`},
+		{args: []string{`-r`, people, `-field`, `Committer`}, want: `Bob <bob@example.com>`},
+		{args: []string{`-r`, people, `-format`, `{{.Author}} / {{.Committer}}`}, want: `Alice <alice@example.com> / Bob <bob@example.com>`},
+		{args: []string{`-r`, people, `-a`}, want: `Version: `, contains: "\n" + author + "\n" + committer + "\n"},
+		{args: []string{`-r`, people, `-a`, `-json`}, want: `{`, contains: `"Author": "Alice <alice@example.com>",` + "\n" + `  "Committer": "Bob <bob@example.com>",`},
+	} {
+		t.Run(strings.Join(tt.args, ` `), func(t *testing.T) {
+			code, out := runOutput(t, tt.args...)
+			if code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+			if !strings.HasPrefix(out, tt.want) {
+				t.Errorf("output %q, want prefix %q", out, tt.want)
+			}
+			if !strings.Contains(out, tt.contains) {
+				t.Errorf("output %q does not contain %q", out, tt.contains)
+			}
+		})
+	}
+}
+
+// TestRunConcurrent runs with different options at the same time do not share them
+func TestRunConcurrent(t *testing.T) {
+	dir := testRepo(t, true)
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			args := []string{`-r`, dir, `-abbrev`, fmt.Sprint(4 + i), `-format`, `{{.Version}} {{.CommitTime | date "2006"}}`}
+			if i%2 == 1 {
+				args = append(args, `-replace`, `s/^v/V/`, `-date-format`, `unix`)
+			}
+			code, out := runOutput(t, args...)
+			version, year, _ := strings.Cut(out, ` `)
+			hash := version[strings.LastIndex(version, `-`)+1:]
+			if code != 0 || len(hash) != 4+i || year != `2024` || strings.HasPrefix(version, `V`) != (i%2 == 1) {
+				t.Errorf("run %d: exit code %d, output %q", i, code, out)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestAbbrev -abbrev sets the hash length of pseudo-versions, Describe and -compat describe,
+// which use git's automatic length without it
+func TestAbbrev(t *testing.T) {
+	dir := testRepo(t, true)
+	commitID := runField(t, dir, `CommitID`)
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, `v1.0.0-20240607153455-` + commitID[:12]},
+		{[]string{`-abbrev`, `8`}, `v1.0.0-20240607153455-` + commitID[:8]},
+		{[]string{`-compat`, `describe`}, `v1.0.0-1-g` + commitID[:7]},
+		{[]string{`-compat`, `describe`, `-abbrev`, `20`}, `v1.0.0-1-g` + commitID[:20]},
+		{[]string{`-field`, `Describe`}, `v1.0.0-1-g` + commitID[:7]},
+		{[]string{`-field`, `Describe`, `-abbrev`, `20`}, `v1.0.0-1-g` + commitID[:20]},
+		{[]string{`-format`, `{{.Version}} {{.Describe}}`, `-abbrev`, `4`}, `v1.0.0-20240607153455-` + commitID[:4] + ` v1.0.0-1-g` + commitID[:4]},
+	} {
+		code, out := runOutput(t, append([]string{`-r`, dir}, tt.args...)...)
+		if code != 0 || strings.TrimSpace(out) != tt.want {
+			t.Errorf("gv %s: exit code %d, output %q, want %q", strings.Join(tt.args, ` `), code, out, tt.want)
+		}
+	}
+}
+
+// TestDetectCILog CI detection of -ci auto and -ci-build-meta is logged to stderr of the run with -v
+func TestDetectCILog(t *testing.T) {
+	dir := testRepo(t, false)
+	for _, e := range ciEnvs {
+		t.Setenv(e[1], ``)
+	}
+	output := filepath.Join(t.TempDir(), `output`)
+	if err := os.WriteFile(output, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(`GITHUB_OUTPUT`, output)
+	t.Setenv(`GITHUB_RUN_NUMBER`, `42`)
+	for _, tt := range []struct {
+		env      string
+		args     []string
+		want     string // stdout
+		wantLogs string // stderr
+	}{
+		{``, []string{`-ci`, `auto`}, `v1.0.0`, `msg="no supported CI system detected, use plain output"`},
+		{`GITHUB_ACTIONS`, []string{`-ci`, `auto`}, `v1.0.0`, `msg="detect CI system" repo=` + dir + ` command=version ci=github env=GITHUB_ACTIONS`},
+		{`GITHUB_ACTIONS`, []string{`-ci-build-meta`}, `v1.0.0+build.42`, `msg="detect CI system" repo=` + dir + ` command=version ci=github`},
+	} {
+		if tt.env != `` {
+			t.Setenv(tt.env, `true`)
+		}
+		var stdout, stderr bytes.Buffer
+		args := append([]string{`-no-ci-branch`, `-v`, `-r`, dir}, tt.args...)
+		if code := run(args, &stdout, &stderr); code != 0 || stdout.String() != tt.want {
+			t.Errorf("%s gv %s: exit code %d, output %q, want %q: %s", tt.env, strings.Join(tt.args, ` `), code, stdout.String(), tt.want, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), tt.wantLogs) {
+			t.Errorf("%s gv %s: logs do not contain %s:\n%s", tt.env, strings.Join(tt.args, ` `), tt.wantLogs, stderr.String())
+		}
+	}
+}
+
+// TestCIBranch branch of HEAD and its source from CI env vars of each CI system: symbolic HEAD first,
+// then the CI branch for detached HEAD if the CI commit is HEAD, then the branches containing HEAD
+func TestCIBranch(t *testing.T) {
+	dir := testRepo(t, true)
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitID := head.Hash().String()
+	other := strings.Repeat(`0`, 40)
+	for _, name := range []string{`GITHUB_ACTIONS`, `GITHUB_HEAD_REF`, `GITHUB_REF_TYPE`, `GITHUB_REF_NAME`, `GITHUB_SHA`,
+		`GITLAB_CI`, `CI_MERGE_REQUEST_SOURCE_BRANCH_NAME`, `CI_COMMIT_BRANCH`, `CI_COMMIT_TAG`, `CI_COMMIT_SHA`,
+		`TF_BUILD`, `BUILD_SOURCEBRANCH`, `BUILD_SOURCEVERSION`, `JENKINS_URL`, `CHANGE_ID`, `BRANCH_NAME`, `GIT_COMMIT`, `TEAMCITY_VERSION`} {
+		t.Setenv(name, ``)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		detached bool
+		env      map[string]string
+		want     string // branch and its source
+	}{
+		{`no CI`, true, nil, `main `},
+		{`GitHub push`, true, map[string]string{`GITHUB_ACTIONS`: `true`, `GITHUB_REF_TYPE`: `branch`, `GITHUB_REF_NAME`: `feature/push`, `GITHUB_SHA`: commitID}, `feature/push ci`},
+		{`GitHub pull request`, true, map[string]string{`GITHUB_ACTIONS`: `true`, `GITHUB_HEAD_REF`: `feature/pr`, `GITHUB_REF_TYPE`: `branch`, `GITHUB_REF_NAME`: `12/merge`, `GITHUB_SHA`: commitID}, `feature/pr ci`},
+		{`GitHub tag`, true, map[string]string{`GITHUB_ACTIONS`: `true`, `GITHUB_REF_TYPE`: `tag`, `GITHUB_REF_NAME`: `v1.0.0`, `GITHUB_SHA`: commitID}, `main `},
+		{`GitHub other commit`, true, map[string]string{`GITHUB_ACTIONS`: `true`, `GITHUB_REF_TYPE`: `branch`, `GITHUB_REF_NAME`: `feature/push`, `GITHUB_SHA`: other}, `main `},
+		{`GitHub symbolic HEAD`, false, map[string]string{`GITHUB_ACTIONS`: `true`, `GITHUB_REF_TYPE`: `branch`, `GITHUB_REF_NAME`: `feature/push`, `GITHUB_SHA`: commitID}, `main `},
+		{`GitLab branch`, true, map[string]string{`GITLAB_CI`: `true`, `CI_COMMIT_BRANCH`: `develop`, `CI_COMMIT_SHA`: commitID}, `develop ci`},
+		{`GitLab merge request`, true, map[string]string{`GITLAB_CI`: `true`, `CI_MERGE_REQUEST_SOURCE_BRANCH_NAME`: `feature/mr`, `CI_COMMIT_SHA`: commitID}, `feature/mr ci`},
+		{`Azure DevOps branch`, true, map[string]string{`TF_BUILD`: `True`, `BUILD_SOURCEBRANCH`: `refs/heads/release/1.0`, `BUILD_SOURCEVERSION`: commitID}, `release/1.0 ci`},
+		{`Azure DevOps pull request`, true, map[string]string{`TF_BUILD`: `True`, `BUILD_SOURCEBRANCH`: `refs/pull/5/merge`, `BUILD_SOURCEVERSION`: commitID}, `main `},
+		{`Jenkins branch`, true, map[string]string{`JENKINS_URL`: `https://ci.example.com/`, `BRANCH_NAME`: `hotfix`, `GIT_COMMIT`: commitID}, `hotfix ci`},
+		{`Jenkins change`, true, map[string]string{`JENKINS_URL`: `https://ci.example.com/`, `BRANCH_NAME`: `PR-7`, `CHANGE_ID`: `7`, `GIT_COMMIT`: commitID}, `main `},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			ref := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(`main`))
+			if tt.detached {
+				ref = plumbing.NewHashReference(plumbing.HEAD, head.Hash())
+			}
+			if err := repo.Storer.SetReference(ref); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			if code := run([]string{`-r`, dir, `-format`, `{{.Branch}} {{.BranchSource}}`}, &stdout, &stderr); code != 0 || stdout.String() != tt.want {
+				t.Errorf("exit code %d, branch and source %q, want %q: %s", code, stdout.String(), tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+// TestPartialClone files filtered out of a partial clone exit with the partial clone code, the version without them is printed
+func TestPartialClone(t *testing.T) {
+	if _, err := exec.LookPath(`git`); err != nil {
+		t.Skip(`git is not installed`)
+	}
+	dir, clone := testRepo(t, true), filepath.Join(t.TempDir(), `clone`)
+	for _, args := range [][]string{
+		{`-C`, dir, `config`, `uploadpack.allowFilter`, `true`},
+		{`clone`, `-q`, `--filter=blob:none`, `--no-checkout`, `file://` + filepath.ToSlash(dir), clone},
+	} {
+		if out, err := exec.Command(`git`, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, ` `), err, out)
+		}
+	}
+	for _, tt := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{`-version-file`, `VERSION`, `-tag-prefix`, `none/`}, exitPartialClone, ``},
+		{[]string{`-a`, `-version-file`, `VERSION`, `-tag-prefix`, `none/`}, exitPartialClone, ``},
+		{nil, 0, `v1.0.0-20240607153455-`},
+	} {
+		code, out := runOutput(t, append([]string{`-r`, clone}, tt.args...)...)
+		if code != tt.code || !strings.HasPrefix(out, tt.want) {
+			t.Errorf("gv %s: exit code %d, output %q, want %d and %q", strings.Join(tt.args, ` `), code, out, tt.code, tt.want)
+		}
+	}
+}
+
+// TestExitCode wrapped errors map to exit codes documented in usage and README
+func TestExitCode(t *testing.T) {
+	wrap := func(err error) error {
+		return fmt.Errorf("get version: %w", fmt.Errorf("find branch: %w", err))
+	}
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{nil, 0},
+		{errors.New(`other`), exitError},
+		{wrap(version.ErrNoRepository), exitNoRepository},
+		{wrap(version.ErrEmptyRepository), exitEmptyRepository},
+		{wrap(version.ErrShallowHistory), exitShallowHistory},
+		{wrap(version.ErrPartialClone), exitPartialClone},
+		{wrap(version.ErrNoBranchFound), exitNoBranchFound},
+		{wrap(fmt.Errorf("%w: %w: commit abc", version.ErrDetachedHead, version.ErrNoBranchFound)), exitDetachedHead},
+		{wrap(version.ErrLimitExceeded), exitLimit},
+		{wrap(context.DeadlineExceeded), exitTimeout},
+		{wrap(fmt.Errorf("%w: %w", version.ErrLimitExceeded, context.DeadlineExceeded)), exitTimeout},
+		{wrap(errUntagged), exitUntagged},
+		{wrap(errNotMerged), exitNotMerged},
+	} {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.code)
+		}
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(`HOME`, home)
+	t.Setenv(`USERPROFILE`, home) // home dir on Windows
+	cur, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := cur.Username
+	if i := strings.LastIndexAny(name, `\`); i >= 0 {
+		name = name[i+1:] // DOMAIN\user on Windows
+	}
+	for _, tt := range []struct {
+		path, want string
+	}{
+		{``, ``},
+		{`~`, home},
+		{`~/`, home + `/`},
+		{`~/work/project`, home + `/work/project`},
+		{`~` + string(filepath.Separator) + `x`, home + string(filepath.Separator) + `x`},
+		{`~` + name + `/x`, cur.HomeDir + `/x`},
+		{`~no-such-user-of-gv/x`, `~no-such-user-of-gv/x`},
+		{`/srv/~/x`, `/srv/~/x`},
+		{`x~`, `x~`},
+		{`relative/path`, `relative/path`},
+	} {
+		got, err := expandHome(tt.path)
+		if err != nil || got != tt.want {
+			t.Errorf("expandHome(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+// TestRunRepoPath -r with '~', relative and absolute paths of worktree or '.git' dir resolve the same repository
+func TestRunRepoPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(`HOME`, home)
+	t.Setenv(`USERPROFILE`, home)
+	dir := filepath.Join(home, `work`, `project`)
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(testRepo(t, false), dir); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(filepath.Join(dir, `.git`)); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+	for _, path := range []string{
+		`~/work/project`,
+		`~/work/project/`,
+		`~/work/project/.git`,
+		dir,
+		filepath.Join(dir, `.git`),
+		`..`,
+		`.`,
+		`../../project/`,
+		`../.git/../`,
+	} {
+		code, out := runOutput(t, `-r`, path, `-format`, `{{.Repo}} {{.Version}}`)
+		if code != 0 || out != `project v1.0.0` {
+			t.Errorf("-r %s: exit code %d, output %q, want 'project v1.0.0'", path, code, out)
+		}
+	}
+}
+
+// TestSourceDateTimeZones output is byte-identical across TZ with SOURCE_DATE_EPOCH, and follows TZ without it,
+// each TZ runs in a child process of the test binary since the local zone is loaded once per process
+func TestSourceDateTimeZones(t *testing.T) {
+	if dir := os.Getenv(`GV_TEST_TZ_REPO`); dir != `` {
+		for _, args := range [][]string{
+			{`-a`, `-json`, `-tz`, `local`, `-r`, dir},
+			{`-sbom`, `cyclonedx`, `-tz`, `local`, `-r`, dir},
+			{`-snapshot`, `-snapshot-unique`, `-tz`, `local`, `-r`, dir},
+			{`-format`, `{{.CommitTime}} {{.AuthorTime}} {{.TagDate}} {{.SinceRelease}} {{.RepoAge}}`, `-tz`, `local`, `-r`, dir},
+		} {
+			var stderr bytes.Buffer
+			if code := run(args, os.Stdout, &stderr); code != 0 {
+				t.Fatalf("gv %s: exit code %d: %s", strings.Join(args, ` `), code, stderr.String())
+			}
+			fmt.Println()
+		}
+		return
+	}
+	dir := testRepo(t, true)
+	output := func(tz, epoch string) string {
+		t.Helper()
+		cmd := exec.Command(os.Args[0], `-test.run=^TestSourceDateTimeZones$`)
+		cmd.Env = append(os.Environ(), `GV_TEST_TZ_REPO=`+dir, `TZ=`+tz, `SOURCE_DATE_EPOCH=`+epoch)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("TZ=%s SOURCE_DATE_EPOCH=%s: %v: %s", tz, epoch, err, out)
+		}
+		return string(out)
+	}
+	zones := []string{`UTC`, `Asia/Tokyo`, `America/New_York`, `Asia/Kolkata`}
+	if _, err := time.LoadLocation(zones[1]); err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	want := output(zones[0], `1717763695`)
+	if !strings.Contains(want, `"timestamp": "2024-06-07T12:34:55Z"`) {
+		t.Errorf("SBOM timestamp is not SOURCE_DATE_EPOCH:\n%s", want)
+	}
+	for _, tz := range zones[1:] {
+		if got := output(tz, `1717763695`); got != want {
+			t.Errorf("TZ=%s output differs from TZ=%s with SOURCE_DATE_EPOCH:\n%s\nwant:\n%s", tz, zones[0], got, want)
+		}
+	}
+	if output(zones[0], ``) == output(zones[1], ``) {
+		t.Errorf("output with -tz local does not follow TZ without SOURCE_DATE_EPOCH")
+	}
+}
+
+// TestLineEndings files checked out with CRLF line endings, e.g. by core.autocrlf on Windows, read like LF ones
+func TestLineEndings(t *testing.T) {
+	for _, eol := range []string{"\n", "\r\n"} {
+		t.Run(strconv.Quote(eol), func(t *testing.T) {
+			dir := testRepo(t, true)
+			config := strings.Join([]string{`# pinned settings`, `version = 1`, `abbrev: 7`, `tag-prefix = "v"`, ``}, eol)
+			if err := os.WriteFile(filepath.Join(dir, `.gitversion`), []byte(config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			code, out := runOutput(t, `-r`, dir)
+			if hash := out[strings.LastIndex(out, `-`)+1:]; code != 0 || !strings.HasPrefix(out, `1.0.0-20240607153455-`) || len(strings.TrimSpace(hash)) != 7 {
+				t.Errorf("exit code %d, version %q, want 1.0.0 pseudo-version with 7 digits hash", code, out)
+			}
+			v := strings.TrimSpace(out)
+			if err := os.WriteFile(filepath.Join(dir, `VERSION`), []byte(v+eol), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if code, out = runOutput(t, `-r`, dir, `-check`, `write-version`); code != 0 || !strings.Contains(out, `is up to date`) {
+				t.Errorf("write-version -check: exit code %d, output %q, want up to date", code, out)
+			}
+			if err := os.WriteFile(filepath.Join(dir, `VERSION`), []byte(`0.9.0`+eol), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if code, _ = runOutput(t, `-r`, dir, `-check`, `write-version`); code != exitStale {
+				t.Errorf("write-version -check on stale file: exit code %d, want %d", code, exitStale)
+			}
+		})
+	}
+}
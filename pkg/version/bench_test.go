@@ -0,0 +1,667 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	commitnode "github.com/go-git/go-git/v5/plumbing/object/commitgraph"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// deepHistory untagged commits above the only tag at root commit of deep history fixture
+const deepHistory = 20000
+
+var (
+	benchRepos sync.Map
+	benchDirs  sync.Map
+	benchRoot  string // dir of disk fixtures shared by benchmarks, removed by TestMain
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if benchRoot != `` {
+		_ = os.RemoveAll(benchRoot)
+	}
+	os.Exit(code)
+}
+
+// benchRepo build in-memory fixture repository once per name, shared by all runs of benchmarks
+func benchRepo(b *testing.B, name string, build func(f *fixture)) *git.Repository {
+	b.Helper()
+	if repo, ok := benchRepos.Load(name); ok {
+		return repo.(*git.Repository)
+	}
+	b.StopTimer()
+	defer b.StartTimer()
+	f := newFixture(b)
+	build(f)
+	benchRepos.Store(name, f.repo)
+	return f.repo
+}
+
+// benchDiskRepo build disk fixture repository once per name like benchRepo, return its worktree dir,
+// the dir outlives each run of a benchmark since b.TempDir is removed after every run
+func benchDiskRepo(b *testing.B, name string, build func(f *fixture)) string {
+	b.Helper()
+	if dir, ok := benchDirs.Load(name); ok {
+		return dir.(string)
+	}
+	b.StopTimer()
+	defer b.StartTimer()
+	if benchRoot == `` {
+		var err error
+		if benchRoot, err = os.MkdirTemp(``, `gv-bench-`); err != nil {
+			b.Fatal(err)
+		}
+	}
+	dir := filepath.Join(benchRoot, name)
+	build(newDiskFixtureAt(b, dir))
+	benchDirs.Store(name, dir)
+	return dir
+}
+
+// benchField get field at HEAD b.N times
+func benchField(b *testing.B, repo *git.Repository, name string, opts Options) (value string) {
+	b.Helper()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		var err error
+		if value, err = FieldRepository(context.Background(), repo, name, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return
+}
+
+func taggedRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `tagged`, func(f *fixture) {
+		f.grow(1000)
+		f.tag(`v1.2.3`)
+	})
+}
+
+func deepHistoryRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `deep`, func(f *fixture) {
+		f.grow(1)
+		f.tag(`v0.1.0`)
+		f.grow(deepHistory)
+	})
+}
+
+// manyBranchesRepo 5000 commits on main and 100 branches forked every 50 commits,
+// HEAD is detached in the middle of main, half of the branches contain it
+func manyBranchesRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `branches`, func(f *fixture) {
+		var forks []plumbing.Hash
+		var middle plumbing.Hash
+		for i := range 100 {
+			forks = append(forks, f.grow(50))
+			if i == 50 {
+				middle = f.head()
+			}
+		}
+		for i, fork := range forks {
+			f.detach(fork)
+			f.grow(5)
+			f.branch(fmt.Sprintf("feature/%03d", i))
+		}
+		f.switchTo(`main`)
+		f.detach(middle)
+	})
+}
+
+// manyTagsRepo 10000 tags on 2000 commits below 1000 untagged commits
+func manyTagsRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `tags`, func(f *fixture) {
+		for i := range 1000 {
+			f.grow(1)
+			for j := range 5 {
+				f.tag(fmt.Sprintf("v0.%d.%d", i, j))
+			}
+		}
+		f.grow(1000)
+	})
+}
+
+func BenchmarkVersionTagged(b *testing.B) {
+	if v := benchField(b, taggedRepo(b), `Version`, Options{}); v != `v1.2.3` {
+		b.Fatalf("version %q, want v1.2.3", v)
+	}
+}
+
+func BenchmarkVersionUntaggedDeepHistory(b *testing.B) {
+	benchField(b, deepHistoryRepo(b), `Version`, Options{})
+}
+
+func BenchmarkFindBranchManyBranches(b *testing.B) {
+	if branch := benchField(b, manyBranchesRepo(b), `Branch`, Options{}); branch != `main` {
+		b.Fatalf("branch %q, want main", branch)
+	}
+}
+
+func BenchmarkNearestTagManyTags(b *testing.B) {
+	repo := manyTagsRepo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		tag, err := newResolver(repo, Options{}.withDefaults()).nearliestTag(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if tag != `v0.1999.4` {
+			b.Fatalf("tag %q, want v0.1999.4", tag)
+		}
+	}
+}
+
+// BenchmarkChangedDeepHistory commits since a tag 10 commits below HEAD in deep history
+func BenchmarkChangedDeepHistory(b *testing.B) {
+	repo := benchRepo(b, `changed`, func(f *fixture) {
+		f.grow(deepHistory)
+		f.tag(`v1.0.0`)
+		f.grow(10)
+	})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		tag, commits, err := ChangedRepository(context.Background(), repo, Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if tag != `v1.0.0` || len(commits) != 10 {
+			b.Fatalf("changed since %q: %d commits, want 10 since v1.0.0", tag, len(commits))
+		}
+	}
+}
+
+// benchLog walk all commits from hash, or from HEAD if it is zero, with go-git log, the baseline of history walks
+func benchLog(b *testing.B, repo *git.Repository, from plumbing.Hash) {
+	b.Helper()
+	b.ResetTimer()
+	for range b.N {
+		iter, err := repo.Log(&git.LogOptions{From: from})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err = iter.ForEach(func(*object.Commit) error { return nil }); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// maxDeepHistoryRatio budget of Version on untagged deep history relative to a go-git log walk of the history,
+// 3 times the ratio when the guard was added, a plain ratio keeps it independent of machine speed
+const maxDeepHistoryRatio = 3 * 1.0 // measured 0.93-1.04
+
+// TestDeepHistoryRegression fail if Version on untagged deep history regresses by more than 3x
+func TestDeepHistoryRegression(t *testing.T) {
+	if testing.Short() {
+		t.Skip(`benchmark guard is skipped in short mode`)
+	}
+	base := testing.Benchmark(func(b *testing.B) {
+		benchLog(b, deepHistoryRepo(b), plumbing.ZeroHash)
+	})
+	version := testing.Benchmark(BenchmarkVersionUntaggedDeepHistory)
+	if base.N == 0 || version.N == 0 {
+		t.Fatal(`benchmark failed`)
+	}
+	ratio := float64(version.NsPerOp()) / float64(base.NsPerOp())
+	t.Logf("version %v/op, log walk %v/op, ratio %.2f", version.NsPerOp(), base.NsPerOp(), ratio)
+	if ratio > maxDeepHistoryRatio {
+		t.Errorf("Version on %d untagged commits takes %.2f times of log walk, budget %.2f", deepHistory, ratio, maxDeepHistoryRatio)
+	}
+}
+
+// taggedCommits get commits with tags of repository, at most n
+func taggedCommits(b *testing.B, repo *git.Repository, n int) (hashes []plumbing.Hash) {
+	b.Helper()
+	tags, err := repo.Tags()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tags.Close()
+	for len(hashes) < n {
+		ref, err := tags.Next()
+		if err != nil {
+			break
+		}
+		hashes = append(hashes, ref.Hash())
+	}
+	return
+}
+
+// BenchmarkTagLookups nearest tag and tags of 10 tagged commits, with the tag map built once per resolver
+// and shared by the lookups, or rebuilt for each lookup as before
+func BenchmarkTagLookups(b *testing.B) {
+	repo := manyTagsRepo(b)
+	hashes := taggedCommits(b, repo, 10)
+	lookup := func(b *testing.B, r *resolver, hash plumbing.Hash) {
+		if names, err := r.tagsAt(context.Background(), hash); err != nil || len(names) != 5 {
+			b.Fatalf("tags at %s: %v %v", hash, names, err)
+		}
+	}
+	b.Run(`shared`, func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			r := newResolver(repo, Options{}.withDefaults())
+			if _, err := r.nearliestTag(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+			for _, hash := range hashes {
+				lookup(b, r, hash)
+			}
+		}
+	})
+	b.Run(`rebuilt`, func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			if _, err := newResolver(repo, Options{}.withDefaults()).nearliestTag(context.Background()); err != nil {
+				b.Fatal(err)
+			}
+			for _, hash := range hashes {
+				lookup(b, newResolver(repo, Options{}.withDefaults()), hash)
+			}
+		}
+	})
+}
+
+// deepBranchesRepo main with deep history and 60 branches forked from its tip, HEAD is detached on a branch
+// forked from the root, which sorts after the others, so all of them are walked before the one containing HEAD
+func deepBranchesRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `deep-branches`, func(f *fixture) {
+		root := f.grow(1)
+		f.tag(`v0.1.0`)
+		tip := f.grow(deepHistory)
+		for i := range 60 {
+			f.detach(tip)
+			f.grow(3)
+			f.branch(fmt.Sprintf("feature/%02d", i))
+		}
+		f.detach(root)
+		head := f.grow(100)
+		f.grow(3)
+		f.branch(`hotfix/deep-history`)
+		f.switchTo(`main`)
+		f.setHead(tip)
+		f.detach(head)
+	})
+}
+
+// logPerBranch branch found by walking go-git log from each branch in order of compare until HEAD is seen,
+// the baseline of findBranch
+func logPerBranch(b *testing.B, repo *git.Repository, compare func(a, b string) int) string {
+	b.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		b.Fatal(err)
+	}
+	branches, err := repo.Branches()
+	if err != nil {
+		b.Fatal(err)
+	}
+	var names []string
+	_ = branches.ForEach(func(ref *plumbing.Reference) error {
+		names = append(names, ref.Name().Short())
+		return nil
+	})
+	slices.SortFunc(names, compare)
+	for _, name := range names {
+		ref, err := repo.Reference(plumbing.NewBranchReferenceName(name), true)
+		if err != nil {
+			b.Fatal(err)
+		}
+		iter, err := repo.Log(&git.LogOptions{From: ref.Hash()})
+		if err != nil {
+			b.Fatal(err)
+		}
+		found := false
+		if err = iter.ForEach(func(c *object.Commit) error {
+			if found = c.Hash == head.Hash(); found {
+				return storer.ErrStop
+			}
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+		if found {
+			return name
+		}
+	}
+	return ``
+}
+
+// BenchmarkFindBranch branch of detached HEAD deep in history with 60 branches, by findBranch walking the
+// history once, and by walking the log of each branch one by one as before
+func BenchmarkFindBranch(b *testing.B) {
+	b.Run(`findBranch`, benchFindBranch)
+	b.Run(`logPerBranch`, func(b *testing.B) {
+		repo := deepBranchesRepo(b)
+		compare := newResolver(repo, Options{}.withDefaults()).compareBranches
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			if branch := logPerBranch(b, repo, compare); branch != `hotfix/deep-history` {
+				b.Fatalf("branch %q, want hotfix/deep-history", branch)
+			}
+		}
+	})
+}
+
+func benchFindBranch(b *testing.B) {
+	repo := deepBranchesRepo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		branch, err := newResolver(repo, Options{}.withDefaults()).findBranch(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if branch != `hotfix/deep-history` {
+			b.Fatalf("branch %q, want hotfix/deep-history", branch)
+		}
+	}
+}
+
+// maxFindBranchRatio budget of findBranch on deep branches relative to a go-git log walk of main,
+// 3 times the ratio when the guard was added, walking each branch down to the root takes about 60 times
+const maxFindBranchRatio = 3 * 1.2 // measured 1.11-1.26
+
+// TestFindBranchRegression fail if findBranch walks the shared history once per branch again
+func TestFindBranchRegression(t *testing.T) {
+	if testing.Short() {
+		t.Skip(`benchmark guard is skipped in short mode`)
+	}
+	base := testing.Benchmark(func(b *testing.B) {
+		repo := deepBranchesRepo(b)
+		main, err := repo.Reference(plumbing.NewBranchReferenceName(`main`), true)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchLog(b, repo, main.Hash())
+	})
+	find := testing.Benchmark(benchFindBranch)
+	if base.N == 0 || find.N == 0 {
+		t.Fatal(`benchmark failed`)
+	}
+	ratio := float64(find.NsPerOp()) / float64(base.NsPerOp())
+	t.Logf("findBranch %v/op, log walk %v/op, ratio %.2f", find.NsPerOp(), base.NsPerOp(), ratio)
+	if ratio > maxFindBranchRatio {
+		t.Errorf("findBranch on 62 branches over %d commits takes %.2f times of log walk, budget %.2f", deepHistory, ratio, maxFindBranchRatio)
+	}
+}
+
+// detachedDeepRepo deep history with HEAD detached one commit below main, so the branch lookup walks the ancestors
+// of HEAD like the nearest tag lookup and the commit count
+func detachedDeepRepo(b *testing.B) *git.Repository {
+	return benchRepo(b, `detached-deep`, func(f *fixture) {
+		f.grow(1)
+		f.tag(`v0.1.0`)
+		head := f.grow(deepHistory)
+		f.grow(1)
+		f.detach(head)
+	})
+}
+
+// BenchmarkDescribeAll version, branch and commit count of detached HEAD as with -a, resolved by one resolver
+// sharing the walk from HEAD, against one resolver per field each walking the history again as before
+func BenchmarkDescribeAll(b *testing.B) {
+	opts := Options{}.withDefaults()
+	resolve := func(b *testing.B, f *fields, name string) {
+		var err error
+		switch name {
+		case `Version`:
+			_, err = f.version()
+		case `Branch`:
+			_, err = f.headBranch()
+		case `Commits`:
+			_, _, _, err = f.firstCommit()
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	names := []string{`Version`, `Branch`, `Commits`}
+	b.Run(`shared`, func(b *testing.B) {
+		repo := detachedDeepRepo(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			f := newFields(context.Background(), repo, opts)
+			for _, name := range names {
+				resolve(b, f, name)
+			}
+		}
+	})
+	b.Run(`separate`, func(b *testing.B) {
+		repo := detachedDeepRepo(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			for _, name := range names {
+				resolve(b, newFields(context.Background(), repo, opts), name)
+			}
+		}
+	})
+}
+
+// wideTreeRepo 1000 commits on disk in one packfile, each one changes one of 1000 files in the root tree,
+// so the trees are large and stored as deltas of each other, and walking them with a path reads delta chains
+func wideTreeRepo(b *testing.B) string {
+	return benchDiskRepo(b, `wide-tree`, func(f *fixture) {
+		entries := make([]object.TreeEntry, 1000)
+		for i := range entries {
+			entries[i] = object.TreeEntry{Name: fmt.Sprintf("file%04d.go", i), Mode: filemode.Regular, Hash: f.blob(`0`)}
+		}
+		entries = append(entries, object.TreeEntry{Name: `main.go`, Mode: filemode.Regular, Hash: f.blob(`0`)})
+		var parents []plumbing.Hash
+		for i := range 1000 {
+			entries[i].Hash = f.blob(fmt.Sprint(i))
+			if i%10 == 0 {
+				entries[1000].Hash = f.blob(fmt.Sprint(i))
+			}
+			sig := f.signature()
+			hash := f.store(&object.Commit{Author: sig, Committer: sig, Message: fmt.Sprintf("commit %d\n", i),
+				TreeHash: f.store(&object.Tree{Entries: slices.Clone(entries)}), ParentHashes: parents})
+			parents = []plumbing.Hash{hash}
+			if i == 0 {
+				f.setHead(hash)
+				f.tag(`v0.1.0`)
+			}
+		}
+		f.setHead(parents[0])
+		f.repack()
+		f.checkout()
+	})
+}
+
+// BenchmarkDescribeCache version of main.go by path, which opens the packed repository with the sized object cache
+// and exclusive access, for several -cache-mb sizes, against go-git default storage opened by PlainOpen as before
+func BenchmarkDescribeCache(b *testing.B) {
+	opts := Options{Paths: []string{`main.go`}}
+	for _, mb := range []int{1, 16, 96, 512} {
+		b.Run(fmt.Sprintf("cache-%dmb", mb), func(b *testing.B) {
+			dir := wideTreeRepo(b)
+			opts := opts
+			opts.CacheMB = mb
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := Field(context.Background(), dir, `Version`, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Run(`PlainOpen`, func(b *testing.B) {
+		dir := wideTreeRepo(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			repo, err := git.PlainOpen(dir)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = FieldRepository(context.Background(), repo, `Version`, opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// hugeTags tags of the 100k tag fixture, one per CI build
+const hugeTags = 100000
+
+// hugeTagsRepo 10000 commits on disk with 10 tags each in packed-refs, below 100 untagged commits
+func hugeTagsRepo(b *testing.B) string {
+	return benchDiskRepo(b, `huge-tags`, func(f *fixture) {
+		var refs []string
+		for i := range hugeTags / 10 {
+			hash := f.grow(1)
+			for j := range 10 {
+				refs = append(refs, fmt.Sprintf("%s refs/tags/v1.%d.%d\n", hash, i, j))
+			}
+		}
+		f.grow(100)
+		f.repack()
+		slices.SortFunc(refs, func(a, b string) int { return strings.Compare(a[41:], b[41:]) })
+		packed := "# pack-refs with: peeled fully-peeled sorted \n" + strings.Join(refs, ``)
+		if err := os.WriteFile(filepath.Join(f.dir, `.git`, `packed-refs`), []byte(packed), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+// BenchmarkVersionHugeTags version by path on 100k tags, the tag map is built from packed-refs
+func BenchmarkVersionHugeTags(b *testing.B) {
+	dir := hugeTagsRepo(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		v, err := Field(context.Background(), dir, `Version`, Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !strings.HasPrefix(v, `v1.9999.9-2024`) {
+			b.Fatalf("version %q, want pseudo-version after v1.9999.9", v)
+		}
+	}
+}
+
+// BenchmarkState repository state for the result cache key on 100k packed tags and on 1001 index entries
+func BenchmarkState(b *testing.B) {
+	for _, tt := range []struct {
+		name string
+		repo func(b *testing.B) string
+	}{
+		{`huge-tags`, hugeTagsRepo},
+		{`wide-tree`, wideTreeRepo},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			dir := tt.repo(b)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				if _, err := State(dir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// budget of version on hugeTags tags: time, and allocated bytes per tag, measured 224ms and 940 bytes
+const (
+	maxHugeTagsTime  = time.Second
+	maxHugeTagsBytes = 2048
+)
+
+// TestHugeTagsBudget fail if version on 100k tags takes more than a second or allocates more than the budget per tag
+func TestHugeTagsBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip(`benchmark guard is skipped in short mode`)
+	}
+	res := testing.Benchmark(BenchmarkVersionHugeTags)
+	if res.N == 0 {
+		t.Fatal(`benchmark failed`)
+	}
+	elapsed, perTag := time.Duration(res.NsPerOp()), res.AllocedBytesPerOp()/hugeTags
+	t.Logf("version on %d tags %v/op, %d bytes/op, %d bytes per tag", hugeTags, elapsed, res.AllocedBytesPerOp(), perTag)
+	if elapsed > maxHugeTagsTime {
+		t.Errorf("version on %d tags takes %v, budget %v", hugeTags, elapsed, maxHugeTagsTime)
+	}
+	if perTag > maxHugeTagsBytes {
+		t.Errorf("version on %d tags allocates %d bytes per tag, budget %d", hugeTags, perTag, maxHugeTagsBytes)
+	}
+}
+
+// graphDeepRepo deep history on disk in one packfile with a commit-graph written by git, 20 branches forked
+// from its top, HEAD is detached one commit below main, skip without git
+func graphDeepRepo(b *testing.B) string {
+	return benchDiskRepo(b, `graph-deep`, func(f *fixture) {
+		f.grow(1)
+		f.tag(`v0.1.0`)
+		head := f.grow(deepHistory)
+		for i := range 20 {
+			f.detach(head)
+			f.grow(2)
+			f.branch(fmt.Sprintf("feature/%02d", i))
+		}
+		f.switchTo(`main`)
+		f.setHead(head)
+		f.grow(1)
+		f.detach(head)
+		f.repack()
+		f.gitCLI(`commit-graph`, `write`, `--reachable`)
+	})
+}
+
+// BenchmarkCommitGraph version, branch and commit count of detached HEAD in deep history,
+// with commits read from the commit-graph file, and from pack objects as without the graph
+func BenchmarkCommitGraph(b *testing.B) {
+	for _, graph := range []bool{true, false} {
+		b.Run(map[bool]string{true: `graph`, false: `objects`}[graph], func(b *testing.B) {
+			repo, err := openRepo(gitDir(graphDeepRepo(b)), 96)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				f := newFields(context.Background(), repo, Options{}.withDefaults())
+				if f.r.commitNodes(); f.r.graph == nil {
+					b.Fatal(`commit-graph is not loaded`)
+				}
+				if !graph {
+					f.r.graph, f.r.nodes = nil, commitnode.NewObjectCommitNodeIndex(repo.Storer)
+				}
+				version, err := f.version()
+				if err != nil {
+					b.Fatal(err)
+				}
+				branch, err := f.headBranch()
+				if err != nil {
+					b.Fatal(err)
+				}
+				commits, _, _, err := f.firstCommit()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if !strings.HasPrefix(version, `v0.1.0-2024`) || branch != `main` || commits != fmt.Sprint(deepHistory+1) {
+					b.Fatalf("version %q branch %q commits %s", version, branch, commits)
+				}
+			}
+		})
+	}
+}
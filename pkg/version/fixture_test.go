@@ -0,0 +1,362 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// fixture repository built commit by commit with go-git objects, commit times advance one minute each
+type fixture struct {
+	tb   testing.TB
+	repo *git.Repository
+	dir  string // worktree of repository on disk, empty in memory
+	when time.Time
+}
+
+// newFixture create an in-memory repository without worktree, HEAD is on branch 'main'
+func newFixture(tb testing.TB) *fixture {
+	tb.Helper()
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return initFixture(tb, repo, ``)
+}
+
+// newDiskFixture create a repository with worktree in a temporary dir, HEAD is on branch 'main',
+// call checkout after commits to get a clean worktree
+func newDiskFixture(tb testing.TB) *fixture {
+	tb.Helper()
+	return newDiskFixtureAt(tb, tb.TempDir())
+}
+
+// newDiskFixtureAt create a repository with worktree in dir like newDiskFixture, dir is not removed after the test
+func newDiskFixtureAt(tb testing.TB, dir string) *fixture {
+	tb.Helper()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return initFixture(tb, repo, dir)
+}
+
+func initFixture(tb testing.TB, repo *git.Repository, dir string) *fixture {
+	tb.Helper()
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(`main`))
+	if err := repo.Storer.SetReference(head); err != nil {
+		tb.Fatal(err)
+	}
+	return &fixture{tb: tb, repo: repo, dir: dir, when: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+// signature next signature, each one is one minute after the previous
+func (f *fixture) signature() object.Signature {
+	f.when = f.when.Add(time.Minute)
+	return object.Signature{Name: `gv`, Email: `gv@example.com`, When: f.when}
+}
+
+// head get commit hash of HEAD, zero hash on unborn branch
+func (f *fixture) head() plumbing.Hash {
+	ref, err := f.repo.Reference(plumbing.HEAD, true)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+	return ref.Hash()
+}
+
+// commit commit changes on HEAD, changes map slash separated file paths to content, empty content deletes the file
+func (f *fixture) commit(msg string, changes map[string]string) plumbing.Hash {
+	f.tb.Helper()
+	var parents []plumbing.Hash
+	if h := f.head(); !h.IsZero() {
+		parents = append(parents, h)
+	}
+	return f.commitParents(msg, changes, parents...)
+}
+
+// merge commit a merge of branch into HEAD with the tree of HEAD
+func (f *fixture) merge(msg, branch string) plumbing.Hash {
+	f.tb.Helper()
+	ref, err := f.repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return f.commitParents(msg, nil, f.head(), ref.Hash())
+}
+
+func (f *fixture) commitParents(msg string, changes map[string]string, parents ...plumbing.Hash) plumbing.Hash {
+	f.tb.Helper()
+	files := make(map[string]string)
+	if len(parents) > 0 {
+		files = f.files(parents[0])
+	}
+	for name, content := range changes {
+		if content == `` {
+			delete(files, name)
+		} else {
+			files[name] = content
+		}
+	}
+	sig := f.signature()
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      msg + "\n",
+		TreeHash:     f.writeTree(files),
+		ParentHashes: parents,
+	}
+	hash := f.store(commit)
+	f.setHead(hash)
+	return hash
+}
+
+// grow commit n commits on HEAD with the tree of HEAD, without reading files of parents
+func (f *fixture) grow(n int) plumbing.Hash {
+	f.tb.Helper()
+	parent := f.head()
+	tree := f.writeTree(nil)
+	if !parent.IsZero() {
+		commit, err := f.repo.CommitObject(parent)
+		if err != nil {
+			f.tb.Fatal(err)
+		}
+		tree = commit.TreeHash
+	}
+	for i := range n {
+		sig := f.signature()
+		commit := &object.Commit{Author: sig, Committer: sig, Message: fmt.Sprintf("commit %d\n", i), TreeHash: tree}
+		if !parent.IsZero() {
+			commit.ParentHashes = []plumbing.Hash{parent}
+		}
+		parent = f.store(commit)
+	}
+	f.setHead(parent)
+	return parent
+}
+
+// setHead move the branch of HEAD, or detached HEAD, to hash
+func (f *fixture) setHead(hash plumbing.Hash) {
+	f.tb.Helper()
+	name := plumbing.HEAD
+	if ref, err := f.repo.Storer.Reference(plumbing.HEAD); err == nil && ref.Type() == plumbing.SymbolicReference {
+		name = ref.Target()
+	}
+	if err := f.repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// files get content of all files in commit
+func (f *fixture) files(hash plumbing.Hash) map[string]string {
+	f.tb.Helper()
+	commit, err := f.repo.CommitObject(hash)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	iter, err := commit.Files()
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	files := make(map[string]string)
+	if err = iter.ForEach(func(file *object.File) error {
+		content, err := file.Contents()
+		files[file.Name] = content
+		return err
+	}); err != nil {
+		f.tb.Fatal(err)
+	}
+	return files
+}
+
+// writeTree store blobs and nested trees of files, entries in git order where dir names sort with trailing '/'
+func (f *fixture) writeTree(files map[string]string) plumbing.Hash {
+	f.tb.Helper()
+	subs := make(map[string]map[string]string)
+	tree := &object.Tree{}
+	for name, content := range files {
+		dir, rest, nested := strings.Cut(name, `/`)
+		if nested {
+			if subs[dir] == nil {
+				subs[dir] = make(map[string]string)
+			}
+			subs[dir][rest] = content
+			continue
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: f.blob(content)})
+	}
+	for dir, sub := range subs {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: f.writeTree(sub)})
+	}
+	sortKey := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + `/`
+		}
+		return e.Name
+	}
+	slices.SortFunc(tree.Entries, func(a, b object.TreeEntry) int { return strings.Compare(sortKey(a), sortKey(b)) })
+	return f.store(tree)
+}
+
+// blob store blob of content
+func (f *fixture) blob(content string) plumbing.Hash {
+	f.tb.Helper()
+	blob := f.repo.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	_, _ = io.WriteString(w, content)
+	_ = w.Close()
+	hash, err := f.repo.Storer.SetEncodedObject(blob)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return hash
+}
+
+// store encode and store object
+func (f *fixture) store(o interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	f.tb.Helper()
+	obj := f.repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		f.tb.Fatal(err)
+	}
+	hash, err := f.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return hash
+}
+
+// branch create branch at HEAD
+func (f *fixture) branch(name string) {
+	f.tb.Helper()
+	if err := f.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), f.head())); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// switchTo point HEAD at branch
+func (f *fixture) switchTo(name string) {
+	f.tb.Helper()
+	if err := f.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(name))); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// detach point HEAD at commit
+func (f *fixture) detach(hash plumbing.Hash) {
+	f.tb.Helper()
+	if err := f.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, hash)); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// tag create lightweight tag at HEAD
+func (f *fixture) tag(name string) {
+	f.tb.Helper()
+	if err := f.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), f.head())); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// annotate create annotated tag at HEAD
+func (f *fixture) annotate(name, msg string) {
+	f.tb.Helper()
+	sig := f.signature()
+	if _, err := f.repo.CreateTag(name, f.head(), &git.CreateTagOptions{Tagger: &sig, Message: msg}); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// repack pack all objects of disk fixture into one packfile
+func (f *fixture) repack() {
+	f.tb.Helper()
+	if err := f.repo.RepackObjects(&git.RepackConfig{}); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// checkout reset worktree and index of disk fixture to HEAD
+func (f *fixture) checkout() {
+	f.tb.Helper()
+	wt, err := f.repo.Worktree()
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	if err = wt.Reset(&git.ResetOptions{Commit: f.head(), Mode: git.HardReset}); err != nil {
+		f.tb.Fatal(err)
+	}
+}
+
+// partialClone clone disk fixture with 'git clone --filter=blob:none --no-checkout' into a new dir,
+// its pack has a '.promisor' file and no blobs, skip the test without git
+func (f *fixture) partialClone() (dir string) {
+	f.tb.Helper()
+	dir = filepath.Join(f.tb.TempDir(), `clone`)
+	f.gitCLI(`config`, `uploadpack.allowFilter`, `true`)
+	f.gitCLI(`clone`, `-q`, `--filter=blob:none`, `--no-checkout`, `file://`+filepath.ToSlash(f.dir), dir)
+	if promisors, _ := filepath.Glob(filepath.Join(dir, `.git`, `objects`, `pack`, `*.promisor`)); len(promisors) == 0 {
+		f.tb.Fatalf("partial clone %s has no promisor pack", dir)
+	}
+	return
+}
+
+// describe describe HEAD of fixture, warnings go to test log
+func (f *fixture) describe(opts Options) Info {
+	f.tb.Helper()
+	if opts.Logger == nil {
+		opts.Logger = testLogger(f.tb)
+	}
+	info, err := DescribeRepository(context.Background(), f.repo, opts)
+	if err != nil {
+		f.tb.Fatal(err)
+	}
+	return info
+}
+
+// gitCLI run git in disk fixture, skip the test without git
+func (f *fixture) gitCLI(args ...string) string {
+	f.tb.Helper()
+	if f.dir == `` {
+		f.tb.Fatal(`git CLI needs disk fixture`)
+	}
+	if _, err := exec.LookPath(`git`); err != nil {
+		f.tb.Skip(`git is not installed`)
+	}
+	cmd := exec.Command(`git`, append([]string{`-C`, f.dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		f.tb.Fatalf("git %s: %v", strings.Join(args, ` `), err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// testLogger logger writing to test log
+func testLogger(tb testing.TB) *slog.Logger {
+	return slog.New(slog.NewTextHandler(testWriter{tb}, nil))
+}
+
+type testWriter struct{ tb testing.TB }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.tb.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,2562 @@
+package version
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	commitgraph "github.com/go-git/go-git/v5/plumbing/format/commitgraph/v2"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	commitnode "github.com/go-git/go-git/v5/plumbing/object/commitgraph"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/text/unicode/norm"
+)
+
+// resolver resolve version information of repository,
+// the expensive lookups are memoized for the lifetime of one resolution
+type resolver struct {
+	repo *git.Repository
+	head *plumbing.Reference        // resolved HEAD, Options.Ref or Options.Commit
+	ref  string                     // revision evaluated instead of HEAD, empty for HEAD
+	hash string                     // full or abbreviated commit hash evaluated instead of HEAD, empty for HEAD
+	tags map[plumbing.Hash][]string // commit hash to its tag names with prefix, sorted by tagsAt on lookup
+	jobs int                        // concurrent branch walks
+
+	maxCommits  int // max commits of one walk, 0 for no limit
+	maxTags     int // max tag references read, 0 for no limit
+	maxBranches int // max branches walked by findBranch, 0 for no limit
+
+	ciBranch  string // branch from CI env vars, used for detached HEAD before searching branches
+	ciTag     string // tag from CI env vars, used as the tag at HEAD if it points at HEAD
+	ciCommit  string // commit built by CI from env vars, CI branch and tag are ignored if it is not HEAD
+	ciChecked *bool  // memoized result of ciTrusted
+
+	priority     []string // glob patterns ordering branches containing HEAD, the others follow by name
+	defBranch    *string  // memoized result of defaultBranch
+	branchSource string   // where headBranch found the branch of detached HEAD: ci, reflog, empty for branches
+
+	prefix     string                    // only tags with the prefix are used
+	loose      bool                      // tags with any text before version after prefix are semantic versions
+	semverOnly bool                      // only tags which are semantic versions are used
+	strictTags bool                      // version tags of different major or minor versions on one commit are an error
+	conflicts  map[plumbing.Hash]error   // commits whose tags are checked by pickTag to the error of their tags
+	namespaces []string                  // only tags under 'refs/tags/<namespace>/' are used, the namespace is cut from names
+	prefer     string                    // tag type sorted first among tags of a commit: annotated, lightweight, any
+	keyring    string                    // armored PGP public keyring verifying tag signatures, empty for no verification
+	signedOnly bool                      // only tags whose signature verifies with keyring are used
+	signed     map[string]tagSignature   // tag name to its verified signature
+	annotated  map[string]bool           // names of annotated tags in tags
+	sorted     map[plumbing.Hash]bool    // commits whose names in tags are sorted
+	logger     *slog.Logger              // Options.Logger, must not be nil
+	paths      []string                  // only commits modifying any of the paths are counted, empty for all
+	ignore     gitignore.Matcher         // changes of matched files do not modify paths, nil for none
+	touched    map[plumbing.Hash]bool    // commits to whether they modify paths
+	pathHashes map[pathKey]plumbing.Hash // commit and path to tree entry hash of path
+
+	graph commitgraph.Index          // commit-graph file of repository, nil if there is none or it is malformed
+	nodes commitnode.CommitNodeIndex // commits read from graph, or from objects if graph lacks them, nil before loaded
+
+	// shared breadth-first walk from HEAD, advanced lazily by tag, branch and distance lookups
+	queue     []plumbing.Hash                   // commits to walk next, nil before the walk starts
+	walked    bool                              // all commits reachable from HEAD are walked
+	ancestors map[plumbing.Hash][]plumbing.Hash // walked commits reachable from HEAD to their parents
+	order     []plumbing.Hash                   // walked commits in breadth-first order
+}
+
+// newResolver create resolver of repository with Options.Jobs, Options.TagPrefix, Options.Paths and Options.Ignore
+func newResolver(repo *git.Repository, opts Options) *resolver {
+	r := &resolver{
+		repo:        repo,
+		ref:         opts.Ref,
+		hash:        opts.Commit,
+		jobs:        max(opts.Jobs, 1),
+		maxCommits:  opts.MaxCommits,
+		maxTags:     opts.MaxTags,
+		maxBranches: opts.MaxBranches,
+		ciBranch:    opts.CIBranch,
+		ciTag:       opts.CITag,
+		ciCommit:    opts.CICommit,
+		priority:    opts.BranchPriority,
+		prefix:      opts.TagPrefix,
+		loose:       opts.LooseVersions,
+		semverOnly:  opts.SemverOnly,
+		strictTags:  opts.StrictTags,
+		conflicts:   make(map[plumbing.Hash]error),
+		namespaces:  opts.TagNamespaces,
+		prefer:      opts.PreferTagType,
+		keyring:     opts.Keyring,
+		signedOnly:  opts.SignedOnly,
+		signed:      make(map[string]tagSignature),
+		annotated:   make(map[string]bool),
+		sorted:      make(map[plumbing.Hash]bool),
+		logger:      opts.Logger,
+		paths:       opts.Paths,
+		touched:     make(map[plumbing.Hash]bool),
+		pathHashes:  make(map[pathKey]plumbing.Hash),
+	}
+	if len(opts.Ignore) > 0 {
+		var patterns []gitignore.Pattern
+		for _, p := range opts.Ignore {
+			patterns = append(patterns, gitignore.ParsePattern(p, nil))
+		}
+		r.ignore = gitignore.NewMatcher(patterns)
+	}
+	return r
+}
+
+// openRepo open git repository at gitRoot with an object cache of cacheMB MiB,
+// the storage assumes no one else writes the repository while it is open, so packed refs and packs are cached.
+// A '.git' file pointing to the git dir elsewhere (worktree, submodule) is opened with the default storage.
+func openRepo(gitRoot string, cacheMB int) (repo *git.Repository, err error) {
+	if fi, e := os.Stat(gitRoot); e == nil && fi.IsDir() {
+		storage := filesystem.NewStorageWithOptions(osfs.New(gitRoot), cache.NewObjectLRU(cache.FileSize(cacheMB)*cache.MiByte),
+			filesystem.Options{ExclusiveAccess: true})
+		repo, err = git.Open(storage, osfs.New(filepath.Dir(gitRoot)))
+	} else {
+		repo, err = git.PlainOpenWithOptions(filepath.Dir(gitRoot), &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: git open repository path %s: %w", ErrNoRepository, filepath.Dir(gitRoot), err)
+	}
+	return repo, nil
+}
+
+// headRef get HEAD reference of repository, or hash reference of the commit r.ref resolves to
+func (r *resolver) headRef() (*plumbing.Reference, error) {
+	if r.head != nil {
+		return r.head, nil
+	}
+	if r.hash != `` {
+		hash, err := r.resolveCommit(r.hash)
+		if err != nil {
+			return nil, err
+		}
+		r.head = plumbing.NewHashReference(plumbing.ReferenceName(r.hash), hash)
+		return r.head, nil
+	}
+	if r.ref != `` {
+		hash, err := r.repo.ResolveRevision(plumbing.Revision(r.ref))
+		if err != nil {
+			return nil, fmt.Errorf("resolve revision %s: %w", r.ref, err)
+		}
+		r.head = plumbing.NewHashReference(plumbing.ReferenceName(r.ref), *hash)
+		return r.head, nil
+	}
+	h, err := r.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, fmt.Errorf("%w: get repository head: %w", ErrEmptyRepository, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get repository head: %w", err)
+	}
+	r.head = h
+	return h, nil
+}
+
+// resolveCommit resolve full or abbreviated commit hash against the object database,
+// annotated tags are peeled to their commits, return ErrAmbiguousCommit with the candidates
+// if several commits have the prefix
+func (r *resolver) resolveCommit(prefix string) (hash plumbing.Hash, err error) {
+	prefix = strings.ToLower(prefix)
+	raw, err := hex.DecodeString(prefix[:len(prefix)/2*2])
+	if err != nil {
+		err = fmt.Errorf("invalid commit hash %s: %w", prefix, err)
+		return
+	}
+	hashes, err := r.hashesWithPrefix(raw)
+	if err != nil {
+		err = fmt.Errorf("find objects with prefix %s: %w", prefix, err)
+		return
+	}
+	var commits []plumbing.Hash
+	for _, h := range hashes {
+		if !strings.HasPrefix(h.String(), prefix) {
+			continue // odd length prefix only matched by whole bytes
+		}
+		obj, err := r.repo.Object(plumbing.AnyObject, h)
+		if err != nil {
+			return hash, fmt.Errorf("get object %s: %w", h, err)
+		}
+		for {
+			if tag, ok := obj.(*object.Tag); ok {
+				if obj, err = tag.Object(); err != nil {
+					return hash, fmt.Errorf("get target of tag %s: %w", tag.Name, err)
+				}
+				continue
+			}
+			break
+		}
+		if commit, ok := obj.(*object.Commit); ok && !slices.Contains(commits, commit.Hash) {
+			commits = append(commits, commit.Hash)
+		}
+	}
+	switch len(commits) {
+	case 0:
+		err = fmt.Errorf("resolve commit %s: %w", prefix, plumbing.ErrObjectNotFound)
+	case 1:
+		hash = commits[0]
+	default:
+		candidates := make([]string, len(commits))
+		for i, c := range commits {
+			candidates[i] = c.String()
+		}
+		slices.Sort(candidates)
+		err = fmt.Errorf("%w: %s, candidates: %s", ErrAmbiguousCommit, prefix, strings.Join(candidates, `, `))
+	}
+	return
+}
+
+// hashesWithPrefix get hashes of all objects starting with prefix bytes,
+// use the packfile indexes and loose object dirs of filesystem storage, or scan all objects of other storages
+func (r *resolver) hashesWithPrefix(prefix []byte) (hashes []plumbing.Hash, err error) {
+	type prefixStorer interface {
+		HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
+	}
+	if s, ok := r.repo.Storer.(prefixStorer); ok {
+		return s.HashesWithPrefix(prefix)
+	}
+	iter, err := r.repo.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return
+	}
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if h := obj.Hash(); bytes.HasPrefix(h[:], prefix) {
+			hashes = append(hashes, h)
+		}
+		return nil
+	})
+	return
+}
+
+// headCommit get commit ID of HEAD
+func (r *resolver) headCommit() (commitID string, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	return h.Hash().String(), nil
+}
+
+// treeHash get hash of root tree of HEAD commit
+func (r *resolver) treeHash() (string, error) {
+	h, err := r.headRef()
+	if err != nil {
+		return ``, err
+	}
+	commit, err := r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return ``, fmt.Errorf("get head commit: %w", err)
+	}
+	return commit.TreeHash.String(), nil
+}
+
+// dirtyHash get stable short hash of uncommitted changes in worktree, empty if the worktree is clean or there is none.
+// The hash covers sorted status entries and contents of changed files, untracked files are included if untracked is true.
+func (r *resolver) dirtyHash(untracked bool) (string, error) {
+	wt, err := r.repo.Worktree()
+	if errors.Is(err, git.ErrIsBareRepository) {
+		return ``, nil
+	}
+	if err != nil {
+		return ``, fmt.Errorf("get worktree: %w", err)
+	}
+	status, err := wt.Status()
+	if err != nil {
+		return ``, fmt.Errorf("get worktree status: %w", err)
+	}
+	var names []string
+	for name, s := range status {
+		if s.Worktree == git.Untracked && !untracked {
+			continue
+		}
+		if s.Staging != git.Unmodified || s.Worktree != git.Unmodified {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ``, nil
+	}
+	slices.Sort(names)
+	h := sha256.New()
+	for _, name := range names {
+		s := status[name]
+		fmt.Fprintf(h, "%c%c %s\n", s.Staging, s.Worktree, name)
+		if s.Worktree == git.Deleted {
+			continue
+		}
+		// checked-out commit of a modified submodule is in its status line, its dir has no content to read
+		if fi, err := wt.Filesystem.Lstat(name); err == nil && fi.IsDir() {
+			continue
+		}
+		f, err := wt.Filesystem.Open(name)
+		if err != nil {
+			return ``, fmt.Errorf("open changed file %s: %w", name, err)
+		}
+		_, err = io.Copy(h, f)
+		_ = f.Close()
+		if err != nil {
+			return ``, fmt.Errorf("read changed file %s: %w", name, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8], nil
+}
+
+// createTag create annotated tag of commit with message under the first of r.namespaces if any,
+// return the tag name in refs/tags/ including the namespace, fail with ErrTagExists if the tag exists
+func (r *resolver) createTag(name string, commit plumbing.Hash, message string, sig object.Signature) (string, error) {
+	if len(r.namespaces) > 0 {
+		name = r.namespaces[0] + `/` + name
+	}
+	if _, err := r.repo.Tag(name); err == nil {
+		return ``, fmt.Errorf("%w: %s", ErrTagExists, name)
+	}
+	if _, err := r.repo.CreateTag(name, commit, &git.CreateTagOptions{Tagger: &sig, Message: message}); err != nil {
+		return ``, fmt.Errorf("create tag %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// tagCommit get commit of tag name, annotated tags are peeled
+func (r *resolver) tagCommit(name string) (plumbing.Hash, error) {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(r.tagRefName(name)))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("get commit of tag %s: %w", name, err)
+	}
+	return *h, nil
+}
+
+// pushTag push tag to remote, fail with ErrTagExists if the remote has the tag already,
+// annotated tags are never fast-forwarded by go-git, so a tag pushed concurrently is not replaced
+func (r *resolver) pushTag(ctx context.Context, remote, name string) error {
+	ref := plumbing.NewTagReferenceName(name)
+	rem, err := r.repo.Remote(remote)
+	if err != nil {
+		return fmt.Errorf("get remote %s: %w", remote, err)
+	}
+	refs, err := rem.ListContext(ctx, &git.ListOptions{})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return fmt.Errorf("list remote %s: %w", remote, err)
+	}
+	if slices.ContainsFunc(refs, func(r *plumbing.Reference) bool { return r.Name() == ref }) {
+		return fmt.Errorf("%w: %s on remote %s", ErrTagExists, name, remote)
+	}
+	err = r.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{config.RefSpec(ref + `:` + ref)},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		if refs, e := rem.ListContext(ctx, &git.ListOptions{}); e == nil && slices.ContainsFunc(refs, func(r *plumbing.Reference) bool {
+			return r.Name() == ref
+		}) {
+			return fmt.Errorf("%w: %s on remote %s: %w", ErrTagExists, name, remote, err) // pushed by another run meanwhile
+		}
+		return fmt.Errorf("push tag %s to %s: %w", name, remote, err)
+	}
+	return nil
+}
+
+// publishTag push the local tag to remote, the tag is removed if the push fails,
+// since a local tag which is not pushed makes later runs think HEAD is tagged already
+func (r *resolver) publishTag(ctx context.Context, remote, name string) (bool, error) {
+	err := r.pushTag(ctx, remote, name)
+	if err == nil {
+		return true, nil
+	}
+	if e := r.repo.DeleteTag(name); e != nil {
+		return false, errors.Join(err, fmt.Errorf("delete tag %s: %w", name, e))
+	}
+	return false, err
+}
+
+// nextPrerelease get prerelease of release in series with counter after the highest existing tag of the series,
+// e.g. 'v1.9.0-rc.3' if 'v1.9.0-rc.2' exists, 'v1.9.0-rc.1' for the first, other series of the release are warned
+func (r *resolver) nextPrerelease(ctx context.Context, release Version, series string) (Version, error) {
+	releases, err := r.releaseTags(ctx)
+	if err != nil {
+		return release, fmt.Errorf("get version tags: %w", err)
+	}
+	n, others := 0, map[string]bool{}
+	for _, t := range releases {
+		v := t.version
+		if v.Prerelease == `` || v.Major != release.Major || v.Minor != release.Minor || v.Patch != release.Patch {
+			continue
+		}
+		if v.Prerelease == series {
+			continue // counter 0
+		}
+		if counter, ok := strings.CutPrefix(v.Prerelease, series+`.`); ok {
+			if c, err := strconv.Atoi(counter); err == nil {
+				n = max(n, c)
+				continue
+			}
+		}
+		name := v.Prerelease
+		if i := strings.LastIndexByte(name, '.'); i > 0 && strings.Trim(name[i+1:], `0123456789`) == `` {
+			name = name[:i]
+		}
+		others[name] = true
+	}
+	if len(others) > 0 {
+		r.logger.Warn("other prerelease series exist for the release, their precedence may differ",
+			`series`, series, `others`, strings.Join(slices.Sorted(maps.Keys(others)), `, `), `release`, release.String())
+	}
+	release.Prerelease = series + `.` + strconv.Itoa(n+1)
+	return release, nil
+}
+
+// fetchTags fetch tags of remote without replacing local tags, tags read before are not updated,
+// use a new resolver to see them
+func (r *resolver) fetchTags(ctx context.Context, remote string) error {
+	err := r.repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{`refs/tags/*:refs/tags/*`},
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("fetch tags of %s: %w", remote, err)
+	}
+	return nil
+}
+
+// tagMap get tag names of each commit, annotated tags are resolved to their target commits,
+// the map is built in one pass of all tags and reused by later calls, names are sorted on lookup by tagsAt.
+// Tag objects are only read for loose tags, or with signedOnly, the others are peeled by packed-refs.
+// With semverOnly, tags which are not semantic versions are skipped, so lookups continue to older tags.
+func (r *resolver) tagMap(ctx context.Context) (map[plumbing.Hash][]string, error) {
+	if r.tags != nil {
+		return r.tags, nil
+	}
+	peeled, plain := r.packedPeels()
+	tags, err := r.tagRefs()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[plumbing.Hash][]string, len(plain)+len(peeled))
+	err = tags.ForEach(func(reference *plumbing.Reference) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := r.tagName(reference.Name())
+		if _, ok := cutTagPrefix(name, r.prefix); !ok {
+			return nil
+		}
+		if _, err := r.tagVersion(name); r.semverOnly && err != nil {
+			r.logger.Debug("ignore tag which is not a semantic version", `tag`, name, `err`, err)
+			return nil
+		}
+		hash := reference.Hash()
+		if commit, ok := peeled[hash]; ok && !r.signedOnly {
+			r.annotated[name] = true
+			m[commit] = append(m[commit], name)
+			return nil
+		}
+		if plain[hash] && !r.signedOnly {
+			m[hash] = append(m[hash], name)
+			return nil
+		}
+		tag, err := r.repo.TagObject(hash)
+		if err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil // annotated tag of non-commit object
+			}
+			hash = commit.Hash
+			r.annotated[name] = true
+		}
+		if r.signedOnly {
+			sig, reason := r.verifyTag(tag)
+			r.signed[name] = sig
+			if sig.status != `yes` {
+				r.logger.Warn("ignore tag without trusted signature", `tag`, name, `err`, reason)
+				return nil
+			}
+		}
+		m[hash] = append(m[hash], name)
+		return nil
+	})
+	for hash, names := range m {
+		m[hash] = r.uniqueTags(names)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.tags = m
+	return m, nil
+}
+
+// tagRefs iterate tag references, only the ones under r.namespaces if they are set
+// iterating fails with ErrLimitExceeded after r.maxTags references
+func (r *resolver) tagRefs() (storer.ReferenceIter, error) {
+	if len(r.namespaces) == 0 {
+		tags, err := r.repo.Tags()
+		if err != nil {
+			return nil, fmt.Errorf("get repository tags: %w", err)
+		}
+		return &limitedRefs{ReferenceIter: tags, max: r.maxTags}, nil
+	}
+	refs, err := r.repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("get repository references: %w", err)
+	}
+	return &limitedRefs{ReferenceIter: storer.NewReferenceFilteredIter(func(reference *plumbing.Reference) bool {
+		return slices.ContainsFunc(r.namespaces, func(ns string) bool {
+			_, ok := cutTagPrefix(string(reference.Name()), `refs/tags/`+ns+`/`)
+			return ok
+		})
+	}, refs), max: r.maxTags}, nil
+}
+
+// limitedRefs tag reference iterator failing with ErrLimitExceeded after max references, no limit if max is 0
+type limitedRefs struct {
+	storer.ReferenceIter
+	max, n int
+}
+
+// Next get next reference, fail if it is beyond the limit
+func (it *limitedRefs) Next() (*plumbing.Reference, error) {
+	ref, err := it.ReferenceIter.Next()
+	if err != nil {
+		return ref, err
+	}
+	if it.n++; it.max > 0 && it.n > it.max {
+		return nil, fmt.Errorf("%w: more than %d tags, raise -max-tags or use -tag-namespace", ErrLimitExceeded, it.max)
+	}
+	return ref, nil
+}
+
+// ForEach call cb for each reference until the limit, storer.ErrStop ends it without error
+func (it *limitedRefs) ForEach(cb func(*plumbing.Reference) error) error {
+	return it.ReferenceIter.ForEach(func(ref *plumbing.Reference) error {
+		if it.n++; it.max > 0 && it.n > it.max {
+			return fmt.Errorf("%w: more than %d tags, raise -max-tags or use -tag-namespace", ErrLimitExceeded, it.max)
+		}
+		return cb(ref)
+	})
+}
+
+// tagName get tag name of reference without 'refs/tags/' and its namespace in r.namespaces
+func (r *resolver) tagName(name plumbing.ReferenceName) string {
+	tag := strings.TrimPrefix(string(name), `refs/tags/`)
+	for _, ns := range r.namespaces {
+		if rest, ok := cutTagPrefix(tag, ns+`/`); ok {
+			return rest
+		}
+	}
+	return tag
+}
+
+// cutTagPrefix cut prefix from tag name like strings.CutPrefix, but compare them in Unicode NFC form,
+// so tags created on macOS in NFD form match the prefix in NFC form and vice versa, e.g. 'björn/v1.2.0',
+// rest keeps the original form of name
+func cutTagPrefix(name, prefix string) (rest string, ok bool) {
+	// the cut must be at a character boundary, not between a letter and its combining mark
+	if rest, ok = strings.CutPrefix(name, prefix); ok && (prefix == `` || norm.NFC.FirstBoundaryInString(rest) <= 0) {
+		return
+	}
+	if norm.NFC.IsNormalString(name) && norm.NFC.IsNormalString(prefix) {
+		return name, false
+	}
+	want := norm.NFC.String(prefix)
+	for i := range name {
+		if norm.NFC.String(name[:i]) == want && norm.NFC.FirstBoundaryInString(name[i:]) == 0 {
+			return name[i:], true
+		}
+	}
+	if want == norm.NFC.String(name) {
+		return ``, true
+	}
+	return name, false
+}
+
+// uniqueTags remove tag names which equal an earlier name in Unicode NFC form, e.g. the same name
+// created in NFD form on macOS and in NFC form on Linux, the first one in reference order is kept
+func (r *resolver) uniqueTags(names []string) []string {
+	if len(names) < 2 {
+		return names
+	}
+	seen := make(map[string]string, len(names))
+	return slices.DeleteFunc(names, func(name string) bool {
+		key := norm.NFC.String(name)
+		if first, ok := seen[key]; ok {
+			r.logger.Debug("ignore tag with the same name in other Unicode normalization form", `tag`, name, `kept`, first)
+			return true
+		}
+		seen[key] = name
+		return false
+	})
+}
+
+// tagRefName get reference name of tag name, in the first of r.namespaces having it
+func (r *resolver) tagRefName(tag string) plumbing.ReferenceName {
+	for _, ns := range r.namespaces {
+		name := plumbing.NewTagReferenceName(ns + `/` + tag)
+		if _, err := r.repo.Storer.Reference(name); err == nil {
+			return name
+		}
+	}
+	return plumbing.NewTagReferenceName(tag)
+}
+
+// tagsAt get tag names of commit hash sorted by r.prefer and r.compareTags, the sorted names are kept in r.tags
+func (r *resolver) tagsAt(ctx context.Context, hash plumbing.Hash) ([]string, error) {
+	tags, err := r.tagMap(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := tags[hash]
+	if len(names) > 1 && !r.sorted[hash] {
+		slices.SortFunc(names, func(a, b string) int {
+			if r.prefer != `any` && r.annotated[a] != r.annotated[b] {
+				if r.annotated[a] == (r.prefer == `annotated`) {
+					return -1
+				}
+				return 1
+			}
+			return r.compareTags(a, b)
+		})
+		r.sorted[hash] = true
+	}
+	return names, nil
+}
+
+// packedPeels read tags in packed-refs which is fully peeled, peeled maps annotated tag object hash to its peeled object,
+// plain has targets of the other tags which are not tag objects, both are empty if packed-refs is missing or not fully peeled
+func (r *resolver) packedPeels() (peeled map[plumbing.Hash]plumbing.Hash, plain map[plumbing.Hash]bool) {
+	storage, ok := r.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return
+	}
+	f, err := storage.Filesystem().Open(`packed-refs`)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), `# pack-refs with:`) ||
+		!slices.Contains(strings.Fields(scanner.Text()), `fully-peeled`) {
+		return
+	}
+	peeled, plain = make(map[plumbing.Hash]plumbing.Hash), make(map[plumbing.Hash]bool)
+	var last plumbing.Hash // target of the previous tag line, zero for other refs
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash, ok := strings.CutPrefix(line, `^`); ok { // peeled object of the previous ref
+			if !last.IsZero() {
+				peeled[last] = plumbing.NewHash(hash)
+				delete(plain, last)
+			}
+			continue
+		}
+		hash, name, ok := strings.Cut(line, ` `)
+		last = plumbing.ZeroHash
+		if !ok || !strings.HasPrefix(name, `refs/tags/`) {
+			continue
+		}
+		last = plumbing.NewHash(hash)
+		if _, ok := peeled[last]; !ok {
+			plain[last] = true
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, nil
+	}
+	return
+}
+
+// tagSignature signature of tag verified with keyring
+type tagSignature struct {
+	status string // yes, no (lightweight or unsigned), invalid
+	signer string // key ID and primary identity of the signer if status is yes, e.g. '0xABCD1234, Release Bot <rel@corp>'
+}
+
+// String get 'good (Key 0xABCD1234, Release Bot <rel@corp>)' for verified signature, 'unverified' otherwise
+func (s tagSignature) String() string {
+	if s.status != `yes` {
+		return `unverified`
+	}
+	return `good (Key ` + s.signer + `)`
+}
+
+// tagSignature get signature of tag name verified with r.keyring, zero if there is no keyring or tag,
+// tags without keyring are never loaded, so the default resolution is not slowed down
+func (r *resolver) tagSignature(name string) tagSignature {
+	if r.keyring == `` || name == `` {
+		return tagSignature{}
+	}
+	if sig, ok := r.signed[name]; ok {
+		return sig
+	}
+	var tag *object.Tag
+	if reference, err := r.repo.Reference(r.tagRefName(name), false); err == nil {
+		tag, _ = r.repo.TagObject(reference.Hash())
+	}
+	sig, reason := r.verifyTag(tag)
+	if reason != nil {
+		r.logger.Debug("verify tag signature", `tag`, name, `err`, reason)
+	}
+	r.signed[name] = sig
+	return sig
+}
+
+// verifyTag verify PGP signature of annotated tag with r.keyring, nil tag is lightweight,
+// reason explains why the signature is not verified
+func (r *resolver) verifyTag(tag *object.Tag) (sig tagSignature, reason error) {
+	switch {
+	case tag == nil:
+		return tagSignature{status: `no`}, errors.New("lightweight tag")
+	case tag.PGPSignature == ``:
+		return tagSignature{status: `no`}, errors.New("unsigned tag")
+	}
+	entity, err := tag.Verify(r.keyring)
+	if err != nil {
+		return tagSignature{status: `invalid`}, err
+	}
+	id := entity.PrimaryKey.KeyIdString()
+	sig = tagSignature{status: `yes`, signer: `0x` + id[max(len(id)-8, 0):]}
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		sig.signer += `, ` + identity.Name
+	}
+	return sig, nil
+}
+
+// tagVersion parse tag name without r.prefix as semantic version, see parseTag
+func (r *resolver) tagVersion(name string) (Version, error) {
+	rest, _ := cutTagPrefix(name, r.prefix)
+	return parseTag(rest, r.loose)
+}
+
+// compareTags order tags by preference: semantic versions first from the highest precedence,
+// then the others in reverse lexical order
+func (r *resolver) compareTags(a, b string) int {
+	va, errA := r.tagVersion(a)
+	vb, errB := r.tagVersion(b)
+	switch {
+	case errA == nil && errB == nil:
+		if c := vb.Compare(va); c != 0 {
+			return c
+		}
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(b, a)
+}
+
+// commitTimes get committer and author time of commit in the given time zone: utc, local, committer
+func (r *resolver) commitTimes(commitID, tz string) (committer, author time.Time, err error) {
+	commit, err := r.repo.CommitObject(plumbing.NewHash(commitID))
+	if err != nil {
+		err = fmt.Errorf("get commit object %s: %w", commitID, err)
+		return
+	}
+	committer, author = inZone(commit.Committer.When, tz), inZone(commit.Author.When, tz)
+	return
+}
+
+// commitPeople get author and committer 'Name <email>' of commit
+func (r *resolver) commitPeople(commitID string) (author, committer string, err error) {
+	commit, err := r.repo.CommitObject(plumbing.NewHash(commitID))
+	if err != nil {
+		err = fmt.Errorf("get commit object %s: %w", commitID, err)
+		return
+	}
+	return commit.Author.String(), commit.Committer.String(), nil
+}
+
+// commitMessage get full message of commit
+func (r *resolver) commitMessage(commitID string) (string, error) {
+	commit, err := r.repo.CommitObject(plumbing.NewHash(commitID))
+	if err != nil {
+		return ``, fmt.Errorf("get commit object %s: %w", commitID, err)
+	}
+	return commit.Message, nil
+}
+
+// releaseTag semantic version tag with its target commit
+type releaseTag struct {
+	name      string
+	version   Version
+	commit    plumbing.Hash
+	when      time.Time // tagger time of annotated tag or committer time of lightweight tag
+	annotated bool
+}
+
+// tagger get tagger 'Name <email>' and tag date of annotated tag name,
+// '<lightweight>' and committer date of target commit for lightweight tag
+func (r *resolver) tagger(name string) (tagger string, when time.Time, err error) {
+	reference, err := r.repo.Reference(r.tagRefName(name), false)
+	if err != nil {
+		err = fmt.Errorf("get tag %s: %w", name, err)
+		return
+	}
+	if tag, err := r.repo.TagObject(reference.Hash()); err == nil {
+		return tag.Tagger.String(), tag.Tagger.When, nil
+	}
+	commit, err := r.repo.CommitObject(reference.Hash())
+	if err != nil {
+		err = fmt.Errorf("get commit of tag %s: %w", name, err)
+		return
+	}
+	return `<lightweight>`, commit.Committer.When, nil
+}
+
+// releaseTags get all semantic version tags with r.prefix pointing at commits
+func (r *resolver) releaseTags(ctx context.Context) (releases []releaseTag, err error) {
+	tags, err := r.tagRefs()
+	if err != nil {
+		return
+	}
+	err = tags.ForEach(func(reference *plumbing.Reference) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := r.tagName(reference.Name())
+		if _, ok := cutTagPrefix(name, r.prefix); !ok {
+			return nil
+		}
+		v, err := r.tagVersion(name)
+		if err != nil {
+			return nil
+		}
+		release := releaseTag{name: name, version: v, commit: reference.Hash()}
+		if tag, err := r.repo.TagObject(reference.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil // annotated tag of non-commit object
+			}
+			release.commit, release.when, release.annotated = commit.Hash, tag.Tagger.When, true
+		} else {
+			commit, err := r.repo.CommitObject(reference.Hash())
+			if err != nil {
+				return nil // lightweight tag of non-commit object
+			}
+			release.when = commit.Committer.When
+		}
+		releases = append(releases, release)
+		return nil
+	})
+	return
+}
+
+// goModule module of go.mod in repository
+type goModule struct {
+	path string // module path
+	dir  string // slash separated dir of go.mod, '.' for the root
+}
+
+// tagPrefix get prefix of the module's version tags Go expects
+func (m goModule) tagPrefix() string {
+	return ModuleTagPrefix(m.path, m.dir)
+}
+
+// modules get modules of go.mod files in HEAD tree, dirs Go ignores are skipped: vendor, testdata,
+// and names starting with '.' or '_'
+func (r *resolver) modules() (modules []goModule, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	commit, err := r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get head commit: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("get tree of commit %s: %w", commit.Hash, r.missing(err))
+	}
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if path.Base(file.Name) != `go.mod` {
+			return nil
+		}
+		dir := path.Dir(file.Name)
+		for _, e := range strings.Split(dir, `/`) {
+			if e == `vendor` || e == `testdata` || strings.HasPrefix(e, `_`) || e != `.` && strings.HasPrefix(e, `.`) {
+				return nil
+			}
+		}
+		data, err := file.Contents()
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file.Name, r.missing(err))
+		}
+		if p := modfile.ModulePath([]byte(data)); p != `` {
+			modules = append(modules, goModule{path: p, dir: dir})
+		}
+		return nil
+	})
+	return modules, r.missing(err)
+}
+
+// orderViolations find tags whose ancestors have a tag of higher version, the commits are walked once in post-order
+// from the tags so each commit knows the highest version tag at it or its ancestors, walks stop at commits older than since
+func (r *resolver) orderViolations(ctx context.Context, tags []releaseTag, since time.Time) (violations []OrderViolation, err error) {
+	at := make(map[plumbing.Hash][]releaseTag)
+	for _, tag := range tags {
+		at[tag.commit] = append(at[tag.commit], tag)
+	}
+	higher := func(a, b *releaseTag) *releaseTag {
+		if a == nil || b != nil && b.version.Compare(a.version) > 0 {
+			return b
+		}
+		return a
+	}
+	highest := make(map[plumbing.Hash]*releaseTag) // walked commit to the highest version tag at it or its ancestors
+	type frame struct {
+		commit *object.Commit
+		next   int // index of the next parent to walk
+	}
+	for _, tag := range tags {
+		if _, ok := highest[tag.commit]; ok {
+			continue
+		}
+		commit, err := r.repo.CommitObject(tag.commit)
+		if err != nil {
+			return nil, fmt.Errorf("get commit of %s: %w", tag.name, err)
+		}
+		stack := []*frame{{commit: commit}}
+		for len(stack) > 0 {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			top := stack[len(stack)-1]
+			if parents := top.commit.ParentHashes; top.next < len(parents) {
+				hash := parents[top.next]
+				top.next++
+				if _, ok := highest[hash]; ok {
+					continue
+				}
+				parent, err := r.repo.CommitObject(hash)
+				if errors.Is(err, plumbing.ErrObjectNotFound) {
+					highest[hash] = nil // beyond shallow boundary
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("get commit %s: %w", hash, err)
+				}
+				if parent.Committer.When.Before(since) {
+					highest[hash] = nil
+					continue
+				}
+				stack = append(stack, &frame{commit: parent})
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			var best *releaseTag
+			for _, hash := range top.commit.ParentHashes {
+				best = higher(best, highest[hash])
+			}
+			here := at[top.commit.Hash]
+			for _, tag := range here {
+				if best != nil && best.version.Compare(tag.version) > 0 {
+					violations = append(violations, OrderViolation{
+						Ancestor: best.name, AncestorCommit: best.commit.String(),
+						Tag: tag.name, TagCommit: tag.commit.String(),
+					})
+				}
+			}
+			for i := range here {
+				best = higher(best, &here[i])
+			}
+			highest[top.commit.Hash] = best
+		}
+	}
+	return
+}
+
+// versionTag find tag of version with r.prefix and its commit: the tag named version,
+// or the semantic version tag of the same precedence, empty if not found
+func (r *resolver) versionTag(ctx context.Context, version string) (tag string, hash plumbing.Hash, err error) {
+	name := r.prefix + version
+	// the tag may be created in other Unicode normalization form than version, e.g. NFD on macOS
+	for _, n := range []string{name, norm.NFC.String(name), norm.NFD.String(name)} {
+		if h, err := r.repo.ResolveRevision(plumbing.Revision(r.tagRefName(n))); err == nil {
+			return n, *h, nil
+		}
+	}
+	want, err := ParseVersion(version)
+	if err != nil {
+		return ``, hash, nil
+	}
+	releases, err := r.releaseTags(ctx)
+	if err != nil {
+		return
+	}
+	for _, release := range releases {
+		if release.version.Compare(want) == 0 && (tag == `` || release.name < tag) {
+			tag, hash = release.name, release.commit
+		}
+	}
+	return
+}
+
+// note get note of HEAD commit in notesRef, empty if there is none,
+// the note is looked up by the commit hash and its fanout paths, e.g. 'ab/cdef...'
+func (r *resolver) note(notesRef string) (note string, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	tree, err := r.notesTree(notesRef)
+	if err != nil || tree == nil {
+		return
+	}
+	id := h.Hash().String()
+	for _, name := range []string{id, id[:2] + `/` + id[2:], id[:2] + `/` + id[2:4] + `/` + id[4:]} {
+		file, err := tree.File(name)
+		if errors.Is(err, object.ErrFileNotFound) || errors.Is(err, object.ErrDirectoryNotFound) {
+			continue
+		}
+		if err != nil {
+			return ``, fmt.Errorf("get note %s: %w", name, err)
+		}
+		return file.Contents()
+	}
+	return
+}
+
+// notesTree get tree of notesRef tip, nil if the ref does not exist
+func (r *resolver) notesTree(notesRef string) (*object.Tree, error) {
+	ref, err := r.repo.Reference(plumbing.ReferenceName(notesRef), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get notes ref %s: %w", notesRef, err)
+	}
+	commit, err := r.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get notes commit %s: %w", ref.Hash(), err)
+	}
+	return commit.Tree()
+}
+
+// setNote add or replace note of HEAD commit in notesRef, remove it if note is empty,
+// a commit of the new notes tree is added on the ref like 'git notes add -f'.
+// Notes in fanout sub trees written by git for large notes trees are not rewritten.
+func (r *resolver) setNote(notesRef, note string, sig object.Signature) error {
+	h, err := r.headRef()
+	if err != nil {
+		return err
+	}
+	old, err := r.repo.Reference(plumbing.ReferenceName(notesRef), true)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return fmt.Errorf("get notes ref %s: %w", notesRef, err)
+	}
+	var parents []plumbing.Hash
+	var entries []object.TreeEntry
+	if old != nil {
+		parents = append(parents, old.Hash())
+		tree, err := r.notesTree(notesRef)
+		if err != nil {
+			return err
+		}
+		entries = slices.Clone(tree.Entries)
+	}
+	id := h.Hash().String()
+	for _, e := range entries {
+		if e.Mode == filemode.Dir && strings.HasPrefix(id, e.Name) {
+			return fmt.Errorf("notes of %s are in fanout tree %s, edit them with 'git notes --ref %s'", id, e.Name, notesRef)
+		}
+	}
+	entries = slices.DeleteFunc(entries, func(e object.TreeEntry) bool { return e.Name == id })
+	if note != `` {
+		blob := r.repo.Storer.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, note+"\n"); err != nil {
+			return err
+		}
+		if err = w.Close(); err != nil {
+			return err
+		}
+		hash, err := r.repo.Storer.SetEncodedObject(blob)
+		if err != nil {
+			return fmt.Errorf("store note: %w", err)
+		}
+		entries = append(entries, object.TreeEntry{Name: id, Mode: filemode.Regular, Hash: hash})
+	}
+	slices.SortFunc(entries, func(a, b object.TreeEntry) int {
+		return strings.Compare(treeEntryKey(a), treeEntryKey(b))
+	})
+	treeHash, err := r.storeObject(&object.Tree{Entries: entries})
+	if err != nil {
+		return fmt.Errorf("store notes tree: %w", err)
+	}
+	message := `Notes added by 'gv note'`
+	if note == `` {
+		message = `Notes removed by 'gv note'`
+	}
+	commitHash, err := r.storeObject(&object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message + "\n",
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	})
+	if err != nil {
+		return fmt.Errorf("store notes commit: %w", err)
+	}
+	ref := plumbing.NewHashReference(plumbing.ReferenceName(notesRef), commitHash)
+	if err = r.repo.Storer.CheckAndSetReference(ref, old); err != nil {
+		return fmt.Errorf("update notes ref %s: %w", notesRef, err)
+	}
+	return nil
+}
+
+// treeEntryKey sort key of tree entry in git order, sub trees are compared with trailing '/'
+func treeEntryKey(e object.TreeEntry) string {
+	if e.Mode == filemode.Dir {
+		return e.Name + `/`
+	}
+	return e.Name
+}
+
+// storeObject encode and store object in repository
+func (r *resolver) storeObject(o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	obj := r.repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return r.repo.Storer.SetEncodedObject(obj)
+}
+
+// countSince count commits reachable from hash but not in previous ancestors,
+// return the ancestors of hash including itself for the next count
+func (r *resolver) countSince(ctx context.Context, hash plumbing.Hash, previous map[plumbing.Hash]bool) (count int, ancestors map[plumbing.Hash]bool, err error) {
+	ancestors = make(map[plumbing.Hash]bool)
+	err = r.reach(ctx, r.commitNodes(), hash, func(node commitnode.CommitNode) (bool, error) {
+		ancestors[node.ID()] = true
+		if !previous[node.ID()] {
+			count++
+		}
+		return true, nil
+	})
+	return
+}
+
+// headBranch get branch name of HEAD commit, or r.ref itself if it names a local or remote branch,
+// a branch containing the commit if r.ref does not name a branch or r.hash is set,
+// return ErrNoBranchFound (and ErrDetachedHead if HEAD is detached) if no branch contains HEAD
+func (r *resolver) headBranch(ctx context.Context, commitID string) (branch string, err error) {
+	head, err := r.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		err = fmt.Errorf("get HEAD reference: %w", err)
+		return
+	}
+	switch {
+	case r.hash != ``:
+		head = plumbing.NewHashReference(plumbing.HEAD, plumbing.ZeroHash) // commit is not HEAD, never report detached HEAD
+	case r.ref != ``:
+		for _, name := range []plumbing.ReferenceName{plumbing.NewBranchReferenceName(r.ref), plumbing.ReferenceName(`refs/remotes/` + r.ref)} {
+			if _, err = r.repo.Storer.Reference(name); err == nil {
+				return name.Short(), nil
+			}
+		}
+		head = plumbing.NewHashReference(plumbing.HEAD, plumbing.ZeroHash) // ref is not HEAD, never report detached HEAD
+	case head.Type() == plumbing.SymbolicReference && head.Target().IsBranch():
+		return head.Target().Short(), nil
+	case r.ciBranch != `` && r.ciTrusted(): // detached HEAD checked out by CI
+		r.branchSource = `ci`
+		return r.ciBranch, nil
+	}
+	branch, err = r.matchBranch(commitID)
+	if err != nil {
+		err = fmt.Errorf("match branch: %w", err)
+		return
+	}
+	if branch == `` && head.Type() == plumbing.HashReference {
+		if branch = r.reflogBranch(); branch != `` {
+			r.branchSource = `reflog`
+			return
+		}
+	}
+	if branch == `` {
+		branch, err = r.findBranch(ctx)
+		if err != nil {
+			err = fmt.Errorf("find branch: %w", err)
+			return
+		}
+	}
+	if branch == `` {
+		if head.Type() == plumbing.HashReference {
+			err = fmt.Errorf("%w: %w: commit %s", ErrDetachedHead, ErrNoBranchFound, commitID)
+		} else {
+			err = fmt.Errorf("%w: commit %s", ErrNoBranchFound, commitID)
+		}
+	}
+	return
+}
+
+// tagDistance count commits reachable from HEAD but not from tag, count all commits if tag is empty,
+// stop with error if the commits walked from HEAD exceed maxDepth which is greater than 0
+func (r *resolver) tagDistance(ctx context.Context, tag string, maxDepth int) (distance int, err error) {
+	if err = r.walkAll(ctx, maxDepth); err != nil {
+		return
+	}
+	seen, err := r.tagAncestors(ctx, tag)
+	if err != nil {
+		return
+	}
+	if len(r.paths) == 0 {
+		return len(r.ancestors) - len(seen), nil
+	}
+	for hash := range r.ancestors {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if seen[hash] {
+			continue
+		}
+		var touched bool
+		if touched, err = r.touches(hash); err != nil {
+			return
+		}
+		if touched {
+			distance++
+		}
+	}
+	return
+}
+
+// sinceTag get commits reachable from HEAD but not from tag in walk order, all commits if tag is empty,
+// only commits modifying r.paths are included if they are set
+func (r *resolver) sinceTag(ctx context.Context, tag string, maxDepth int) (commits []plumbing.Hash, err error) {
+	if err = r.walkAll(ctx, maxDepth); err != nil {
+		return
+	}
+	seen, err := r.tagAncestors(ctx, tag)
+	if err != nil {
+		return
+	}
+	for _, hash := range r.order {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if seen[hash] {
+			continue
+		}
+		if len(r.paths) > 0 {
+			var touched bool
+			if touched, err = r.touches(hash); err != nil {
+				return
+			}
+			if !touched {
+				continue
+			}
+		}
+		commits = append(commits, hash)
+	}
+	return
+}
+
+// contributors count commits of each author since tag, authors are the same if their emails equal case-insensitively
+// after mapped by .mailmap at HEAD, the result is sorted by commits count descending
+func (r *resolver) contributors(ctx context.Context, tag string, maxDepth int) (authors []Contributor, err error) {
+	commits, err := r.sinceTag(ctx, tag, maxDepth)
+	if err != nil {
+		return
+	}
+	mailmap, err := r.mailmap()
+	if err != nil {
+		return
+	}
+	index := make(map[string]int)
+	for _, hash := range commits {
+		commit, err := r.repo.CommitObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("get commit object %s: %w", hash, err)
+		}
+		name, email := mailmap.resolve(commit.Author.Name, commit.Author.Email)
+		key := strings.ToLower(email)
+		i, ok := index[key]
+		if !ok {
+			i = len(authors)
+			index[key] = i
+			authors = append(authors, Contributor{Name: name, Email: email}) // newest name of the author
+		}
+		authors[i].Commits++
+	}
+	slices.SortStableFunc(authors, func(a, b Contributor) int {
+		return cmp.Or(b.Commits-a.Commits, strings.Compare(a.Name, b.Name))
+	})
+	return
+}
+
+// diffStat count changed files, inserted and deleted lines between trees of tag and HEAD, from empty tree if tag is empty,
+// only files under r.paths are counted if they are set, changes of files matching r.ignore do not count
+func (r *resolver) diffStat(ctx context.Context, tag string) (stat DiffStat, err error) {
+	var from *object.Tree
+	if tag != `` {
+		hash, err := r.tagCommit(tag)
+		if err != nil {
+			return stat, err
+		}
+		commit, err := r.repo.CommitObject(hash)
+		if err != nil {
+			return stat, fmt.Errorf("get commit of tag %s: %w", tag, r.missing(err))
+		}
+		if from, err = commit.Tree(); err != nil {
+			return stat, fmt.Errorf("get tree of tag %s: %w", tag, r.missing(err))
+		}
+	}
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	commit, err := r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return stat, fmt.Errorf("get head commit: %w", err)
+	}
+	to, err := commit.Tree()
+	if err != nil {
+		return stat, fmt.Errorf("get head tree: %w", r.missing(err))
+	}
+	changes, err := object.DiffTreeContext(ctx, from, to)
+	if err != nil {
+		return stat, fmt.Errorf("diff tree: %w", r.missing(err))
+	}
+	for _, change := range changes {
+		name := cmp.Or(change.To.Name, change.From.Name)
+		if len(r.paths) > 0 && !slices.ContainsFunc(r.paths, func(p string) bool { return name == p || strings.HasPrefix(name, p+`/`) }) {
+			continue
+		}
+		if r.ignore != nil && r.ignore.Match(strings.Split(name, `/`), false) {
+			continue
+		}
+		patch, err := change.PatchContext(ctx)
+		if err != nil {
+			return stat, fmt.Errorf("diff %s: %w", name, r.missing(err))
+		}
+		stat.Files++
+		for _, fs := range patch.Stats() {
+			stat.Insertions += fs.Addition
+			stat.Deletions += fs.Deletion
+		}
+	}
+	return
+}
+
+// mailmapEntry proper name and email of an author in .mailmap, empty if not changed
+type mailmapEntry struct {
+	name, email string
+}
+
+// mailmap lower case commit email, or lower case commit email and name joined with '\n', to proper identity
+type mailmap map[string]mailmapEntry
+
+// mailmapReg match '[Proper Name] <proper@email> [[Commit Name] <commit@email>]' line of .mailmap
+var mailmapReg = regexp.MustCompile(`^\s*([^<]*?)\s*<([^>]*)>\s*(?:([^<]*?)\s*<([^>]*)>)?`)
+
+// mailmap read .mailmap in HEAD commit, empty if there is none
+func (r *resolver) mailmap() (mailmap, error) {
+	h, err := r.headRef()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get head commit: %w", err)
+	}
+	file, err := r.file(commit, `.mailmap`)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get .mailmap: %w", r.missing(err))
+	}
+	data, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("read .mailmap: %w", r.missing(err))
+	}
+	m := make(mailmap)
+	for _, line := range strings.Split(data, "\n") {
+		line, _, _ = strings.Cut(line, `#`)
+		match := mailmapReg.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if match[4] == `` { // 'Proper Name <commit@email>'
+			m[strings.ToLower(match[2])] = mailmapEntry{name: match[1]}
+			continue
+		}
+		key := strings.ToLower(match[4])
+		if match[3] != `` {
+			key += "\n" + match[3]
+		}
+		m[key] = mailmapEntry{name: match[1], email: match[2]}
+	}
+	return m, nil
+}
+
+// resolve get proper name and email of commit name and email, entries with commit name take precedence
+func (m mailmap) resolve(name, email string) (string, string) {
+	e, ok := m[strings.ToLower(email)+"\n"+name]
+	if !ok {
+		e = m[strings.ToLower(email)]
+	}
+	return cmp.Or(e.name, name), cmp.Or(e.email, email)
+}
+
+// walkAll walk all commits reachable from HEAD, fail if history is shallow or has more than maxDepth commits
+func (r *resolver) walkAll(ctx context.Context, maxDepth int) error {
+	shallow, err := r.repo.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("get shallow commits: %w", err)
+	}
+	if len(shallow) > 0 {
+		return fmt.Errorf("%w: can not count commits, fetch full history with 'git fetch --unshallow'", ErrShallowHistory)
+	}
+	if err = r.walk(ctx, func(plumbing.Hash) bool {
+		return maxDepth > 0 && len(r.order) > maxDepth
+	}); err != nil {
+		return err
+	}
+	if maxDepth > 0 && len(r.order) > maxDepth {
+		return fmt.Errorf("commits count exceeds max depth %d", maxDepth)
+	}
+	return nil
+}
+
+// firstCommit count commits reachable from HEAD and get committer time of its oldest root commit,
+// histories of unrelated repositories merged have multiple root commits
+func (r *resolver) firstCommit(ctx context.Context, maxDepth int) (commits int, first time.Time, err error) {
+	if err = r.walkAll(ctx, maxDepth); err != nil {
+		return
+	}
+	for _, hash := range r.order {
+		if len(r.ancestors[hash]) > 0 {
+			continue
+		}
+		commit, err := r.repo.CommitObject(hash)
+		if err != nil {
+			return 0, first, fmt.Errorf("get root commit %s: %w", hash, err)
+		}
+		if first.IsZero() || commit.Committer.When.Before(first) {
+			first = commit.Committer.When
+		}
+	}
+	return len(r.order), first, nil
+}
+
+// tagAncestors get commits reachable from both tag and HEAD, empty if tag is empty,
+// the walk from HEAD must be finished
+func (r *resolver) tagAncestors(ctx context.Context, tag string) (seen map[plumbing.Hash]bool, err error) {
+	seen = make(map[plumbing.Hash]bool)
+	if tag == `` {
+		return
+	}
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(r.tagRefName(tag)))
+	if err != nil {
+		err = fmt.Errorf("resolve tag %s: %w", tag, err)
+		return
+	}
+	if _, ok := r.ancestors[*hash]; ok {
+		// ancestors of a walked commit are all walked, collect them from the recorded parents
+		for stack := []plumbing.Hash{*hash}; len(stack) > 0; {
+			h := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !seen[h] {
+				seen[h] = true
+				stack = append(stack, r.ancestors[h]...)
+			}
+		}
+		return
+	}
+	err = r.reach(ctx, r.commitNodes(), *hash, func(node commitnode.CommitNode) (bool, error) {
+		if _, ok := r.ancestors[node.ID()]; ok {
+			seen[node.ID()] = true
+		}
+		return true, nil
+	})
+	if err != nil {
+		err = fmt.Errorf("walk tag %s: %w", tag, err)
+	}
+	return
+}
+
+// sinceSlop commits walked on after the walk of commitsSince could stop, for commits with skewed committer time,
+// same as SLOP of git revision walk
+const sinceSlop = 5
+
+// commitsSince get commits reachable from HEAD but not from base, in breadth-first order from HEAD, like
+// 'git rev-list base..HEAD' walk from both in committer time order, only the history since base is walked,
+// the walk stops once all queued commits are reachable from base and older than any commit found
+func (r *resolver) commitsSince(ctx context.Context, base plumbing.Hash) (commits []plumbing.Hash, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	nodes := r.commitNodes()
+	const (
+		seen = 1 << iota
+		popped
+		uninteresting // reachable from base
+		listed
+	)
+	flags := make(map[plumbing.Hash]uint32)
+	parents := make(map[plumbing.Hash][]plumbing.Hash)
+	queue := &commitQueue{}
+	// mark commit with flag, queue it if not seen, commits walked before reached from base pass it to their parents
+	mark := func(hash plumbing.Hash, flag uint32) error {
+		old := flags[hash]
+		flags[hash] |= seen | flag
+		if old&seen == 0 {
+			node, err := nodes.Get(hash)
+			if err != nil {
+				return fmt.Errorf("get commit %s: %w", hash, err)
+			}
+			heap.Push(queue, node)
+			return nil
+		}
+		if flag == 0 || old&uninteresting != 0 || old&popped == 0 {
+			return nil
+		}
+		for stack := slices.Clone(parents[hash]); len(stack) > 0; {
+			p := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if flags[p]&uninteresting == 0 {
+				flags[p] |= uninteresting
+				stack = append(stack, parents[p]...)
+			}
+		}
+		return nil
+	}
+	if err = mark(h.Hash(), 0); err != nil {
+		return
+	}
+	if err = mark(base, uninteresting); err != nil {
+		return
+	}
+	var oldest time.Time // oldest commit not reachable from base so far
+	slop := sinceSlop
+	for walked := 0; queue.Len() > 0; walked++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !slices.ContainsFunc(queue.commits, func(c commitnode.CommitNode) bool { return flags[c.ID()]&uninteresting == 0 }) &&
+			(oldest.IsZero() || queue.commits[0].CommitTime().Before(oldest)) {
+			if slop--; slop == 0 {
+				break
+			}
+		} else {
+			slop = sinceSlop
+		}
+		if r.maxCommits > 0 && walked >= r.maxCommits {
+			return nil, r.commitLimit()
+		}
+		c := heap.Pop(queue).(commitnode.CommitNode)
+		flags[c.ID()] |= popped
+		parents[c.ID()] = c.ParentHashes()
+		flag := flags[c.ID()] & uninteresting
+		if flag == 0 && (oldest.IsZero() || c.CommitTime().Before(oldest)) {
+			oldest = c.CommitTime()
+		}
+		for _, p := range c.ParentHashes() {
+			if err = mark(p, flag); err != nil {
+				return
+			}
+		}
+	}
+	for queue := []plumbing.Hash{h.Hash()}; len(queue) > 0; queue = queue[1:] {
+		hash := queue[0]
+		if flags[hash]&(seen|uninteresting|listed) != seen {
+			continue
+		}
+		flags[hash] |= listed
+		commits = append(commits, hash)
+		queue = append(queue, parents[hash]...)
+	}
+	return
+}
+
+// touches check whether commit modifies any of r.paths, every commit touches if no path is set
+func (r *resolver) touches(hash plumbing.Hash) (bool, error) {
+	if len(r.paths) == 0 {
+		return true, nil
+	}
+	if touched, ok := r.touched[hash]; ok {
+		return touched, nil
+	}
+	var touched bool
+	for _, p := range r.paths {
+		t, err := r.touchesPath(hash, p)
+		if err != nil {
+			return false, err
+		}
+		if t {
+			touched = true
+			break
+		}
+	}
+	r.touched[hash] = touched
+	return touched, nil
+}
+
+// touchesPath check whether commit modifies path, that is the path differs from all parents,
+// changes of files matching r.ignore do not count
+func (r *resolver) touchesPath(hash plumbing.Hash, p string) (bool, error) {
+	own, err := r.pathHash(hash, p)
+	if err != nil {
+		return false, err
+	}
+	parents := r.ancestors[hash]
+	if len(parents) == 0 {
+		if own.IsZero() {
+			return false, nil
+		}
+		ignored, err := r.onlyIgnored(plumbing.ZeroHash, own, p)
+		return !ignored, err
+	}
+	for _, parent := range parents {
+		ph, err := r.pathHash(parent, p)
+		if err != nil {
+			return false, err
+		}
+		if ph == own {
+			return false, nil // same as one parent, the change came from that parent
+		}
+		if ignored, err := r.onlyIgnored(ph, own, p); err != nil || ignored {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// onlyIgnored check whether all changes between entry hashes a and b of path are files matching r.ignore
+func (r *resolver) onlyIgnored(a, b plumbing.Hash, p string) (bool, error) {
+	if r.ignore == nil {
+		return false, nil
+	}
+	ta, errA := r.entryTree(a)
+	tb, errB := r.entryTree(b)
+	if errA != nil || errB != nil { // path is file in either commit
+		return r.ignore.Match(strings.Split(p, `/`), false), nil
+	}
+	changes, err := object.DiffTree(ta, tb)
+	if err != nil {
+		return false, fmt.Errorf("diff tree of %s: %w", p, r.missing(err))
+	}
+	for _, change := range changes {
+		name := change.To.Name
+		if name == `` {
+			name = change.From.Name
+		}
+		if !r.ignore.Match(strings.Split(p+`/`+name, `/`), false) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// entryTree get tree of entry hash, nil tree for zero hash
+func (r *resolver) entryTree(hash plumbing.Hash) (*object.Tree, error) {
+	if hash.IsZero() {
+		return nil, nil
+	}
+	return r.repo.TreeObject(hash)
+}
+
+// pathHash get hash of tree entry of path in commit, zero hash if the path does not exist,
+// equal hashes mean equal contents so sub trees are never compared file by file
+func (r *resolver) pathHash(hash plumbing.Hash, p string) (plumbing.Hash, error) {
+	key := pathKey{hash, p}
+	if h, ok := r.pathHashes[key]; ok {
+		return h, nil
+	}
+	commit, err := r.repo.CommitObject(hash)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("get commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("get tree of commit %s: %w", hash, r.missing(err))
+	}
+	var h plumbing.Hash
+	entry, err := tree.FindEntry(p)
+	switch {
+	case err == nil:
+		h = entry.Hash
+	case errors.Is(err, object.ErrEntryNotFound), errors.Is(err, object.ErrDirectoryNotFound):
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("find %s in commit %s: %w", p, hash, r.missing(err))
+	}
+	r.pathHashes[key] = h
+	return h, nil
+}
+
+// file get file of commit like commit.File, object.ErrFileNotFound if the path is no file in its tree,
+// but plumbing.ErrObjectNotFound if the blob is missing, e.g. filtered out of partial clone, which commit.File also hides
+func (r *resolver) file(commit *object.Commit, name string) (*object.File, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := tree.FindEntry(name)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) || err == nil && !entry.Mode.IsFile() {
+		return nil, object.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	blob, err := r.repo.BlobObject(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewFile(name, entry.Mode, blob), nil
+}
+
+// missing explain missing object error in partial clone with ErrPartialClone, other errors are returned as is.
+// Version computation only needs commits, tags and refs, which partial clones always have,
+// but trees of -path and blobs of files like go.mod, -version-file and .mailmap may be filtered out.
+func (r *resolver) missing(err error) error {
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return err
+	}
+	cfg, e := r.repo.Config()
+	if e != nil {
+		return err
+	}
+	partial := cfg.Raw.Section(`extensions`).Option(`partialclone`) != ``
+	for _, remote := range cfg.Raw.Section(`remote`).Subsections {
+		partial = partial || remote.Option(`promisor`) == `true`
+	}
+	if !partial {
+		return err
+	}
+	return fmt.Errorf("%w: %w, fetch the objects with 'git fetch --refetch' or clone without --filter", ErrPartialClone, err)
+}
+
+// pathKey commit and path of memoized tree entry hash
+type pathKey struct {
+	commit plumbing.Hash
+	path   string
+}
+
+// walk advance the shared breadth-first walk from HEAD until stop returns true for a newly walked commit,
+// or all commits reachable from HEAD are walked when stop is nil or never returns true
+func (r *resolver) walk(ctx context.Context, stop func(plumbing.Hash) bool) error {
+	nodes := r.commitNodes()
+	if r.ancestors == nil {
+		h, err := r.headRef()
+		if err != nil {
+			return err
+		}
+		if _, err = nodes.Get(h.Hash()); err != nil {
+			return fmt.Errorf("get head commit: %w", err)
+		}
+		r.queue = []plumbing.Hash{h.Hash()}
+		r.ancestors = make(map[plumbing.Hash][]plumbing.Hash)
+	}
+	for !r.walked {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if len(r.queue) == 0 {
+			r.queue, r.walked = nil, true
+			break
+		}
+		hash := r.queue[0]
+		if _, ok := r.ancestors[hash]; ok {
+			r.queue = r.queue[1:]
+			continue
+		}
+		if r.maxCommits > 0 && len(r.order) >= r.maxCommits {
+			return r.commitLimit()
+		}
+		node, err := nodes.Get(hash)
+		if err != nil {
+			return fmt.Errorf("walk commits from HEAD: get commit %s: %w", hash, err)
+		}
+		r.queue = r.queue[1:]
+		parents := node.ParentHashes()
+		r.ancestors[hash] = parents
+		r.order = append(r.order, hash)
+		for _, parent := range parents {
+			if _, ok := r.ancestors[parent]; !ok {
+				r.queue = append(r.queue, parent)
+			}
+		}
+		if stop != nil && stop(hash) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// commitNodes get commits with their parents from the commit-graph file written by 'git commit-graph write',
+// 'git gc' or 'git maintenance', which is much faster than parsing commit objects, commits missing in a stale
+// graph and all commits without graph are read from objects
+func (r *resolver) commitNodes() commitnode.CommitNodeIndex {
+	if r.nodes == nil {
+		if r.graph = r.commitGraph(); r.graph != nil {
+			r.nodes = commitnode.NewGraphCommitNodeIndex(r.graph, r.repo.Storer)
+		} else {
+			r.nodes = commitnode.NewObjectCommitNodeIndex(r.repo.Storer)
+		}
+	}
+	return r.nodes
+}
+
+// commitGraph load 'objects/info/commit-graph', or the split graph of 'objects/info/commit-graphs/commit-graph-chain',
+// into memory, nil if there is none, it is malformed, or 'core.commitGraph' is false
+func (r *resolver) commitGraph() commitgraph.Index {
+	storage, ok := r.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+	if cfg, err := r.repo.Config(); err == nil && cfg.Raw.Section(`core`).Option(`commitGraph`) == `false` {
+		return nil
+	}
+	fs := storage.Filesystem()
+	open := func(name string, parent commitgraph.Index) (commitgraph.Index, error) {
+		data, err := util.ReadFile(fs, name)
+		if err != nil {
+			return nil, err
+		}
+		return commitgraph.OpenFileIndexWithParent(graphFile{bytes.NewReader(data)}, parent)
+	}
+	index, err := open(path.Join(`objects`, `info`, `commit-graph`), nil)
+	if errors.Is(err, os.ErrNotExist) {
+		var data []byte
+		if data, err = util.ReadFile(fs, path.Join(`objects`, `info`, `commit-graphs`, `commit-graph-chain`)); err == nil {
+			var chain []string
+			chain, err = commitgraph.OpenChainFile(bytes.NewReader(data))
+			for _, hash := range chain {
+				if err != nil {
+					break
+				}
+				index, err = open(path.Join(`objects`, `info`, `commit-graphs`, `graph-`+hash+`.graph`), index)
+			}
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		r.logger.Debug("ignore commit-graph, read commit objects instead", `err`, err)
+		return nil
+	}
+	return index
+}
+
+// commitLimit error of a walk exceeding r.maxCommits
+func (r *resolver) commitLimit() error {
+	return fmt.Errorf("%w: more than %d commits walked, raise -max-commits", ErrLimitExceeded, r.maxCommits)
+}
+
+// graphFile commit-graph file read into memory, nothing to close
+type graphFile struct {
+	*bytes.Reader
+}
+
+func (graphFile) Close() error { return nil }
+
+// reach walk commits reachable from hash through nodes in depth-first preorder, each commit once, at most r.maxCommits,
+// visit returns false to skip the parents of the commit, or an error to end the walk, storer.ErrStop ends it without error
+func (r *resolver) reach(ctx context.Context, nodes commitnode.CommitNodeIndex, hash plumbing.Hash, visit func(commitnode.CommitNode) (bool, error)) error {
+	seen := make(map[plumbing.Hash]bool)
+	for stack := []plumbing.Hash{hash}; len(stack) > 0; {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		h := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[h] {
+			continue
+		}
+		if r.maxCommits > 0 && len(seen) >= r.maxCommits {
+			return r.commitLimit()
+		}
+		seen[h] = true
+		node, err := nodes.Get(h)
+		if err != nil {
+			return fmt.Errorf("get commit %s: %w", h, err)
+		}
+		descend, err := visit(node)
+		if errors.Is(err, storer.ErrStop) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !descend {
+			continue
+		}
+		parents := node.ParentHashes()
+		for i := len(parents) - 1; i >= 0; i-- {
+			if !seen[parents[i]] {
+				stack = append(stack, parents[i])
+			}
+		}
+	}
+	return nil
+}
+
+// contains check whether target is reachable from tip through nodes, commits matching skip are not walked,
+// nor commits whose generation in commit-graph is not higher than the generation of target, they can not reach it
+func (r *resolver) contains(ctx context.Context, nodes commitnode.CommitNodeIndex, tip, target plumbing.Hash, skip func(plumbing.Hash) bool) (found bool, err error) {
+	node, err := nodes.Get(target)
+	if err != nil {
+		return false, fmt.Errorf("get commit %s: %w", target, err)
+	}
+	// generation is MaxUint64 for commits not in commit-graph, and 0 in graphs written by git before 2.18
+	gen := node.Generation()
+	pruned := gen != 0 && gen != math.MaxUint64
+	err = r.reach(ctx, nodes, tip, func(n commitnode.CommitNode) (bool, error) {
+		if n.ID() == target {
+			found = true
+			return false, storer.ErrStop
+		}
+		return !skip(n.ID()) && (!pruned || n.Generation() > gen), nil
+	})
+	return
+}
+
+// findTag get tag at HEAD if it exists
+func (r *resolver) findTag(ctx context.Context) (tag string, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	if tag = r.ciTagAt(h.Hash()); tag != `` {
+		return
+	}
+	names, err := r.tagsAt(ctx, h.Hash())
+	if err == nil && len(names) > 0 {
+		tag, err = r.pickTag(h.Hash(), names)
+	}
+	return
+
+	// fallback to run git command
+	//	1: git tag --points-at HEAD
+	//	2: git pack-refs; awk -F 'tags/' /$(git rev-parse HEAD)/'{print $2}' .git/packed-refs
+	//err = os.Chdir(filepath.Dir(gitRoot))
+	//if err != nil {
+	//	slog.Error("change dir", `err`, err)
+	//	return
+	//}
+	//cmd := exec.Command(`sh`, `-c`, `git tag --points-at HEAD 2> /dev/null | sort -V | tail -1`)
+	//output, err := cmd.Output()
+	//if err != nil {
+	//	slog.Error("git cmd output", `err`, err)
+	//	return
+	//}
+	//tag = string(output)
+}
+
+// ciTrusted report whether CI env vars describe HEAD, it is false with a warning if the commit built by CI is not HEAD,
+// e.g. gv runs in a different checkout, or -ref or -commit evaluates another commit
+func (r *resolver) ciTrusted() bool {
+	if r.ciChecked != nil {
+		return *r.ciChecked
+	}
+	trusted := r.ref == `` && r.hash == ``
+	if h, err := r.headRef(); trusted && err == nil && r.ciCommit != `` && !strings.EqualFold(r.ciCommit, h.Hash().String()) {
+		r.logger.Warn("ignore branch and tag from CI env vars of another commit", `commit`, r.ciCommit, `head`, h.Hash().String())
+		trusted = false
+	}
+	r.ciChecked = &trusted
+	return trusted
+}
+
+// ciTagAt get r.ciTag without namespace if it points at commit hash, so tags are not iterated,
+// empty with a warning if it does not, or if tags must be verified
+func (r *resolver) ciTagAt(hash plumbing.Hash) string {
+	if r.ciTag == `` || r.signedOnly || !r.ciTrusted() {
+		return ``
+	}
+	ref := plumbing.NewTagReferenceName(r.ciTag)
+	name := r.tagName(ref)
+	if _, ok := cutTagPrefix(name, r.prefix); len(r.namespaces) > 0 && name == r.ciTag || !ok {
+		return `` // out of scope of tag namespaces or prefix
+	}
+	target, err := r.repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		r.logger.Warn("resolve tag from CI env vars", `tag`, r.ciTag, `err`, err)
+		return ``
+	}
+	if *target != hash {
+		r.logger.Warn("tag from CI env vars does not point at HEAD", `tag`, r.ciTag, `commit`, target.String())
+		return ``
+	}
+	return name
+}
+
+// pickTag get the first of sorted tag names of commit hash, warn once per commit with the chosen tag and why it is
+// chosen if its version tags differ in major or minor version, e.g. a botched re-tag, return ErrTagConflict instead with strictTags
+func (r *resolver) pickTag(hash plumbing.Hash, names []string) (string, error) {
+	err, ok := r.conflicts[hash]
+	if !ok {
+		var versions []string
+		var first Version
+		for _, name := range names {
+			v, e := r.tagVersion(name)
+			if e != nil {
+				continue
+			}
+			if len(versions) == 0 {
+				first = v
+			} else if v.Major != first.Major || v.Minor != first.Minor {
+				err = ErrTagConflict
+			}
+			versions = append(versions, name)
+		}
+		if err != nil {
+			err = fmt.Errorf("%w: commit %s has tags %s", err, hash, strings.Join(versions, `, `))
+			if !r.strictTags {
+				reason := `highest version`
+				if highest := slices.MinFunc(names, r.compareTags); highest != names[0] {
+					reason = r.prefer + ` tag preferred over higher ` + highest
+				}
+				r.logger.Warn("version tags on one commit differ, use the chosen tag", `tag`, names[0], `reason`, reason, `err`, err)
+				err = nil
+			}
+		}
+		r.conflicts[hash] = err
+	}
+	if err != nil {
+		return ``, err
+	}
+	return names[0], nil
+}
+
+// findTags get all tags at HEAD sorted by r.compareTags
+func (r *resolver) findTags(ctx context.Context) (tags []string, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	names, err := r.tagsAt(ctx, h.Hash())
+	return slices.Clone(names), err
+}
+
+// nearliestTag find the nearliest tag reachable from HEAD by breadth-first walk, r.paths do not apply,
+// release tags often sit on commits not modifying a component, they only filter commits counted since the tag
+func (r *resolver) nearliestTag(ctx context.Context) (tag string, err error) {
+	tags, err := r.tagMap(ctx)
+	if err != nil || len(tags) == 0 {
+		return
+	}
+	for _, hash := range r.order {
+		if len(tags[hash]) > 0 {
+			names, _ := r.tagsAt(ctx, hash)
+			return r.pickTag(hash, names)
+		}
+	}
+	var pickErr error
+	if err = r.walk(ctx, func(hash plumbing.Hash) bool {
+		if len(tags[hash]) > 0 {
+			names, _ := r.tagsAt(ctx, hash)
+			tag, pickErr = r.pickTag(hash, names)
+			return true
+		}
+		return false
+	}); err != nil {
+		return
+	}
+	return tag, pickErr
+}
+
+// describeCandidates max tags considered by describe, same as 'git describe --candidates' default
+const describeCandidates = 10
+
+// describeTag candidate tag of describe with its commits count, same as possible_tag of git describe
+type describeTag struct {
+	name  string
+	depth int    // commits walked which are not reachable from the tag
+	flag  uint32 // bit marking commits reachable from the tag
+	order int    // order found by the walk
+}
+
+// commitQueue commits ordered by committer time, newest first, commits of the same time in insertion order
+type commitQueue struct {
+	commits []commitnode.CommitNode
+	seq     []int
+	next    int
+}
+
+func (q *commitQueue) Len() int { return len(q.commits) }
+func (q *commitQueue) Less(i, j int) bool {
+	a, b := q.commits[i].CommitTime().Unix(), q.commits[j].CommitTime().Unix()
+	return a > b || a == b && q.seq[i] < q.seq[j]
+}
+func (q *commitQueue) Swap(i, j int) {
+	q.commits[i], q.commits[j] = q.commits[j], q.commits[i]
+	q.seq[i], q.seq[j] = q.seq[j], q.seq[i]
+}
+func (q *commitQueue) Push(x any) {
+	q.commits = append(q.commits, x.(commitnode.CommitNode))
+	q.seq = append(q.seq, q.next)
+	q.next++
+}
+func (q *commitQueue) Pop() any {
+	n := len(q.commits) - 1
+	c := q.commits[n]
+	q.commits, q.seq = q.commits[:n], q.seq[:n]
+	return c
+}
+
+// describe get the tag chosen by 'git describe --tags' for HEAD and the count of commits since it,
+// computed by the same walk in committer time order over at most describeCandidates tags, empty if no tag is reachable
+func (r *resolver) describe(ctx context.Context) (tag string, depth int, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	tags, err := r.tagMap(ctx)
+	if err != nil {
+		return
+	}
+	if tag = r.describeName(h.Hash(), tags[h.Hash()]); tag != `` {
+		return
+	}
+	shallow, err := r.repo.Storer.Shallow()
+	if err != nil {
+		err = fmt.Errorf("get shallow commits: %w", err)
+		return
+	}
+	nodes := r.commitNodes()
+	head, err := nodes.Get(h.Hash())
+	if err != nil {
+		err = fmt.Errorf("get head commit: %w", err)
+		return
+	}
+	const seen = 1
+	flags := map[plumbing.Hash]uint32{head.ID(): seen}
+	queue := &commitQueue{}
+	heap.Push(queue, head)
+	// push parents of c to queue if not seen, and mark them with the flags of c
+	pushParents := func(c commitnode.CommitNode) error {
+		if slices.Contains(shallow, c.ID()) {
+			return nil
+		}
+		for _, hash := range c.ParentHashes() {
+			if flags[hash]&seen == 0 {
+				parent, err := nodes.Get(hash)
+				if err != nil {
+					return fmt.Errorf("get commit %s: %w", hash, err)
+				}
+				heap.Push(queue, parent)
+			}
+			flags[hash] |= flags[c.ID()]
+		}
+		return nil
+	}
+	var candidates []*describeTag
+	var annotated, walked int
+	for queue.Len() > 0 {
+		if ctx.Err() != nil {
+			return ``, 0, ctx.Err()
+		}
+		c := heap.Pop(queue).(commitnode.CommitNode)
+		if walked++; r.maxCommits > 0 && walked > r.maxCommits {
+			return ``, 0, r.commitLimit()
+		}
+		if name := r.describeName(c.ID(), tags[c.ID()]); name != `` {
+			if len(candidates) == describeCandidates {
+				heap.Push(queue, c) // gave up on it, its depth is counted by finishing the best candidate
+				break
+			}
+			t := &describeTag{name: name, depth: walked - 1, flag: 1 << (len(candidates) + 1), order: len(candidates) + 1}
+			candidates = append(candidates, t)
+			flags[c.ID()] |= t.flag
+			if r.annotated[name] {
+				annotated++
+			}
+		}
+		for _, t := range candidates {
+			if flags[c.ID()]&t.flag == 0 {
+				t.depth++
+			}
+		}
+		if annotated > 0 && queue.Len() == 0 { // stop if the last path is covered by the best candidates
+			best, within := math.MaxInt, uint32(0)
+			for _, t := range candidates {
+				if t.depth < best {
+					best, within = t.depth, t.flag
+				} else if t.depth == best {
+					within |= t.flag
+				}
+			}
+			if flags[c.ID()]&within == within {
+				break
+			}
+		}
+		if err = pushParents(c); err != nil {
+			return
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	slices.SortStableFunc(candidates, func(a, b *describeTag) int {
+		return cmp.Or(cmp.Compare(a.depth, b.depth), cmp.Compare(a.order, b.order))
+	})
+	best := candidates[0]
+	for queue.Len() > 0 { // finish depth of the best candidate
+		if ctx.Err() != nil {
+			return ``, 0, ctx.Err()
+		}
+		c := heap.Pop(queue).(commitnode.CommitNode)
+		if flags[c.ID()]&best.flag != 0 {
+			if !slices.ContainsFunc(queue.commits, func(o commitnode.CommitNode) bool { return flags[o.ID()]&best.flag == 0 }) {
+				break
+			}
+		} else {
+			best.depth++
+		}
+		if err = pushParents(c); err != nil {
+			return
+		}
+	}
+	return best.name, best.depth, nil
+}
+
+// describeName get the tag of commit among names chosen like git describe: annotated tags first, the latest tagged
+// of them, then the first lightweight tag by name, empty if names is empty
+func (r *resolver) describeName(hash plumbing.Hash, names []string) (name string) {
+	var when time.Time
+	for _, n := range slices.Sorted(slices.Values(names)) {
+		switch {
+		case name == ``:
+			name = n
+			if r.annotated[n] {
+				_, when, _ = r.tagger(n)
+			}
+		case r.annotated[n] && !r.annotated[name]:
+			name = n
+			_, when, _ = r.tagger(n)
+		case r.annotated[n]:
+			if _, t, _ := r.tagger(n); t.After(when) {
+				name, when = n, t
+			}
+		}
+	}
+	return
+}
+
+// abbrevHash abbreviate hash like git to n hex digits like '--abbrev=<n>', if n is 0 to core.abbrev of git config,
+// or by count of packed objects at least 7 hex digits, extended until no other object shares the prefix
+func (r *resolver) abbrevHash(hash plumbing.Hash, n int) (string, error) {
+	if cfg, err := r.repo.Config(); err == nil && n == 0 {
+		if v, err := strconv.Atoi(cfg.Raw.Section(`core`).Option(`abbrev`)); err == nil {
+			n = min(max(v, 4), 40)
+		}
+	}
+	if n == 0 {
+		// about 2^k objects expect a collision at k/2 bits, i.e. ceil(k/2) hex digits with 4 bits each
+		n = max((bits.Len(uint(r.packedObjects()))+1)/2, 7)
+	}
+	id := hash.String()
+	for ; n < len(id); n++ {
+		prefix, err := hex.DecodeString(id[:n&^1])
+		if err != nil {
+			return ``, err
+		}
+		hashes, err := r.hashesWithPrefix(prefix)
+		if err != nil {
+			return ``, err
+		}
+		if !slices.ContainsFunc(hashes, func(o plumbing.Hash) bool { return o != hash && strings.HasPrefix(o.String(), id[:n]) }) {
+			break
+		}
+	}
+	return id[:n], nil
+}
+
+// packedObjects count objects in packs by their index headers, as git approximates the object count
+func (r *resolver) packedObjects() (count int) {
+	storage, ok := r.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return
+	}
+	packs, err := storage.ObjectPacks()
+	if err != nil {
+		return
+	}
+	for _, pack := range packs {
+		f, err := storage.Filesystem().Open(`objects/pack/pack-` + pack.String() + `.idx`)
+		if err != nil {
+			continue
+		}
+		header := make([]byte, 8+256*4) // magic, version and fan-out table of index v2
+		if _, err = io.ReadFull(f, header); err == nil && bytes.Equal(header[:4], []byte{0xff, 't', 'O', 'c'}) {
+			count += int(binary.BigEndian.Uint32(header[len(header)-4:]))
+		}
+		_ = f.Close()
+	}
+	return
+}
+
+// matchBranch match branch whose tip is HEAD commit ID, the first one by compareBranches if several match
+func (r *resolver) matchBranch(commitID string) (branch string, err error) {
+	branches, err := r.repo.Branches()
+	if err != nil {
+		err = fmt.Errorf("get branches: %w", err)
+		return
+	}
+	err = branches.ForEach(func(reference *plumbing.Reference) error {
+		name := reference.Name().Short()
+		if reference.Hash().String() == commitID && (branch == `` || r.compareBranches(name, branch) < 0) {
+			branch = name
+		}
+		return nil
+	})
+	return
+}
+
+// compareBranches order branch names by the first matching pattern of priority, then the default branch first,
+// then shorter names first, then by name, so the branch found for HEAD never depends on ref iteration order
+func (r *resolver) compareBranches(a, b string) int {
+	def := r.defaultBranch()
+	rank := func(branch string) int {
+		for i, pattern := range r.priority {
+			if ok, _ := path.Match(pattern, branch); ok {
+				return i
+			}
+		}
+		if branch == def {
+			return len(r.priority)
+		}
+		return len(r.priority) + 1
+	}
+	return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(len(a), len(b)), strings.Compare(a, b))
+}
+
+// defaultBranch get default branch of repository: the target of 'refs/remotes/origin/HEAD',
+// or init.defaultBranch of git config if the branch exists, or main, or master, empty if none exists
+func (r *resolver) defaultBranch() string {
+	if r.defBranch != nil {
+		return *r.defBranch
+	}
+	r.defBranch = new(string)
+	exists := func(branch string) bool {
+		_, err := r.repo.Storer.Reference(plumbing.NewBranchReferenceName(branch))
+		return branch != `` && err == nil
+	}
+	var candidates []string
+	if ref, err := r.repo.Storer.Reference(plumbing.NewRemoteHEADReferenceName(`origin`)); err == nil && ref.Type() == plumbing.SymbolicReference {
+		candidates = append(candidates, strings.TrimPrefix(ref.Target().String(), `refs/remotes/origin/`))
+	}
+	if cfg, err := r.repo.ConfigScoped(config.GlobalScope); err == nil {
+		candidates = append(candidates, cfg.Init.DefaultBranch)
+	}
+	for _, branch := range append(candidates, `main`, `master`) {
+		if exists(branch) {
+			*r.defBranch = branch
+			break
+		}
+	}
+	return *r.defBranch
+}
+
+// mergedToDefault check if HEAD is an ancestor of the target of 'refs/remotes/origin/HEAD',
+// or of the local default branch without it: 'true', 'false', or 'unknown' if neither can be resolved
+func (r *resolver) mergedToDefault(ctx context.Context) (string, error) {
+	target, err := r.repo.Reference(plumbing.NewRemoteHEADReferenceName(`origin`), true)
+	if err != nil {
+		branch := r.defaultBranch()
+		if branch == `` {
+			return `unknown`, nil
+		}
+		if target, err = r.repo.Reference(plumbing.NewBranchReferenceName(branch), true); err != nil {
+			return `unknown`, nil
+		}
+	}
+	h, err := r.headRef()
+	if err != nil {
+		return ``, err
+	}
+	merged, err := r.contains(ctx, r.commitNodes(), target.Hash(), h.Hash(), func(plumbing.Hash) bool { return false })
+	if err != nil {
+		return ``, fmt.Errorf("check ancestor of %s: %w", target.Name().Short(), err)
+	}
+	return strconv.FormatBool(merged), nil
+}
+
+// reflogBranch get the branch which detached HEAD is checked out from by the latest
+// 'checkout: moving from <branch> to <commit>' entry of HEAD reflog, entries moving from
+// a commit or a deleted branch are skipped, empty if there is no reflog
+func (r *resolver) reflogBranch() string {
+	storage, ok := r.repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return ``
+	}
+	f, err := storage.Filesystem().Open(`logs/HEAD`)
+	if err != nil {
+		return ``
+	}
+	defer f.Close()
+	var moves []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		_, message, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if from, ok := strings.CutPrefix(message, `checkout: moving from `); ok {
+			if from, _, ok = strings.Cut(from, ` to `); ok {
+				moves = append(moves, from)
+			}
+		}
+	}
+	if scanner.Err() != nil {
+		return ``
+	}
+	for _, from := range slices.Backward(moves) {
+		if _, err = r.repo.Storer.Reference(plumbing.NewBranchReferenceName(from)); err == nil {
+			return from
+		}
+	}
+	return ``
+}
+
+// findBranch get branch where the HEAD belongs to, the first one by compareBranches if several branches contain HEAD.
+// Branches are walked concurrently, each walk stops at the ancestors of HEAD from the shared walk
+// since they can not reach HEAD, and branches after an already found one are skipped.
+// Commits of a finished walk which did not meet HEAD can not reach HEAD either, so later walks stop at them,
+// which visits each commit about once instead of once per branch.
+func (r *resolver) findBranch(ctx context.Context) (branch string, err error) {
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	branches, err := r.repo.Branches()
+	if err != nil {
+		err = fmt.Errorf("get branches: %w", err)
+		return
+	}
+	var refs []*plumbing.Reference
+	if err = branches.ForEach(func(reference *plumbing.Reference) error {
+		refs = append(refs, reference)
+		return nil
+	}); err != nil {
+		err = fmt.Errorf("list branches: %w", err)
+		return
+	}
+	if r.maxBranches > 0 && len(refs) > r.maxBranches {
+		err = fmt.Errorf("%w: %d branches to walk, more than %d, raise -max-branches or check out a branch", ErrLimitExceeded, len(refs), r.maxBranches)
+		return
+	}
+	slices.SortFunc(refs, func(a, b *plumbing.Reference) int {
+		return r.compareBranches(a.Name().Short(), b.Name().Short())
+	})
+	// a failed walk still holds ancestors of HEAD only, so its error is ignored unless the walk must stop
+	if err = r.walk(ctx, nil); ctx.Err() != nil {
+		return ``, ctx.Err()
+	} else if errors.Is(err, ErrLimitExceeded) {
+		return
+	}
+	stop := make(map[plumbing.Hash]bool, len(r.ancestors))
+	for hash := range r.ancestors {
+		stop[hash] = hash != h.Hash()
+	}
+
+	// go-git storages are not safe for concurrent reads, so the walks read objects through a lock,
+	// the commit-graph in memory is safe for them
+	locked := lockedStorer{EncodedObjectStorer: r.repo.Storer, mu: new(sync.Mutex)}
+	nodes := commitnode.NewObjectCommitNodeIndex(locked)
+	if r.commitNodes(); r.graph != nil {
+		nodes = commitnode.NewGraphCommitNodeIndex(r.graph, locked)
+	}
+	var mu sync.Mutex
+	first := len(refs)                   // index of the first branch found containing HEAD
+	dead := make(map[plumbing.Hash]bool) // commits of finished walks not meeting HEAD
+	skip := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i > first
+	}
+	unreachable := func(hash plumbing.Hash) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return dead[hash]
+	}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(r.jobs)
+	for i, reference := range refs {
+		if skip(i) {
+			break
+		}
+		g.Go(func() error {
+			if skip(i) {
+				return nil
+			}
+			// the stop map is only read by the walks, so it is shared by all of them
+			var walked []plumbing.Hash
+			found, err := r.contains(gctx, nodes, reference.Hash(), h.Hash(), func(hash plumbing.Hash) bool {
+				walked = append(walked, hash)
+				return stop[hash] || unreachable(hash) || skip(i)
+			})
+			if err != nil {
+				return fmt.Errorf("walk branch %s: %w", reference.Name().Short(), err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if found {
+				first = min(first, i)
+			} else if i < first { // the walk was not cut short by skip, so none of its commits reaches HEAD
+				for _, hash := range walked {
+					dead[hash] = true
+				}
+			}
+			return nil
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return
+	}
+	if first < len(refs) {
+		branch = refs[first].Name().Short()
+	}
+	return
+}
+
+// lockedStorer serialize object reads of storer
+type lockedStorer struct {
+	storer.EncodedObjectStorer
+	mu *sync.Mutex
+}
+
+// EncodedObject get object of storer with the lock held
+func (s lockedStorer) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.EncodedObjectStorer.EncodedObject(t, h)
+}
@@ -0,0 +1,357 @@
+package version
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TestNearliestTagWithPath tag of a component on a commit not modifying the component is still its nearliest tag
+func TestNearliestTagWithPath(t *testing.T) {
+	f := newFixture(t)
+	f.commit(`foo1`, map[string]string{`services/foo/main.go`: `1`, `services/bar/main.go`: `1`})
+	f.commit(`bar1`, map[string]string{`services/bar/main.go`: `2`})
+	f.tag(`foo/v1.0.0`)
+	f.commit(`bar2`, map[string]string{`services/bar/main.go`: `3`})
+	opts := Options{Paths: []string{`services/foo`}, TagPrefix: `foo/`}
+
+	if info := f.describe(opts); info.Version != `v1.0.0` || info.Tag != `foo/v1.0.0` {
+		t.Errorf("version %q tag %q, want v1.0.0 at foo/v1.0.0", info.Version, info.Tag)
+	}
+	tag, commits, err := ChangedRepository(context.Background(), f.repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != `foo/v1.0.0` || len(commits) != 0 {
+		t.Errorf("changed since %q: %v, want nothing since foo/v1.0.0", tag, commits)
+	}
+
+	f.commit(`foo2`, map[string]string{`services/foo/main.go`: `2`})
+	f.commit(`bar3`, map[string]string{`services/bar/main.go`: `4`})
+	tag, commits, err = ChangedRepository(context.Background(), f.repo, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != `foo/v1.0.0` || len(commits) != 1 || commits[0].Subject != `foo2` {
+		t.Errorf("changed since %q: %v, want only foo2 since foo/v1.0.0", tag, commits)
+	}
+	if info := f.describe(opts); info.Tag != `foo/v1.0.0` || info.Version == `v1.0.0` {
+		t.Errorf("version %q tag %q, want pseudo-version after foo/v1.0.0", info.Version, info.Tag)
+	}
+}
+
+// TestChangedSinceTag commits since the tag include the ones merged from a branch forked before the tag,
+// and only the history since the tag is walked
+func TestChangedSinceTag(t *testing.T) {
+	f := newFixture(t)
+	f.commit(`init`, map[string]string{`main.go`: `1`})
+	f.grow(500)
+	f.branch(`old`)
+	f.switchTo(`old`)
+	f.commit(`old`, map[string]string{`old.go`: `1`})
+	f.switchTo(`main`)
+	f.commit(`bar`, map[string]string{`bar.go`: `1`})
+	f.tag(`v1.0.0`)
+	opts := Options{MaxCommits: 20}
+
+	for _, tt := range []struct {
+		name string
+		grow func()
+		want []string
+	}{
+		{`tag at HEAD`, func() {}, nil},
+		{`merged`, func() {
+			f.commit(`foo`, map[string]string{`foo.go`: `1`})
+			f.merge(`merge old`, `old`)
+		}, []string{`merge old`, `foo`, `old`}},
+	} {
+		tt.grow()
+		tag, commits, err := ChangedRepository(context.Background(), f.repo, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var subjects []string
+		for _, c := range commits {
+			subjects = append(subjects, c.Subject)
+		}
+		if tag != `v1.0.0` || !slices.Equal(subjects, tt.want) {
+			t.Errorf("%s: changed since %q: %q, want %q since v1.0.0", tt.name, tag, subjects, tt.want)
+		}
+	}
+}
+
+// TestPickTagWarning warning about differing version tags on one commit names the chosen tag and why
+func TestPickTagWarning(t *testing.T) {
+	f := newFixture(t)
+	f.commit(`init`, map[string]string{`main.go`: `1`})
+	f.tag(`v2.0.0`)
+	f.annotate(`v1.4.0`, `release v1.4.0`)
+	for _, tt := range []struct {
+		prefer, tag, reason string
+	}{
+		{`any`, `v2.0.0`, `reason="highest version"`},
+		{`lightweight`, `v2.0.0`, `reason="highest version"`},
+		{`annotated`, `v1.4.0`, `reason="annotated tag preferred over higher v2.0.0"`},
+	} {
+		var log bytes.Buffer
+		info := f.describe(Options{PreferTagType: tt.prefer, Logger: slog.New(slog.NewTextHandler(&log, nil))})
+		if info.Tag != tt.tag {
+			t.Errorf("prefer %s: tag %q, want %q", tt.prefer, info.Tag, tt.tag)
+		}
+		if want := `tag=` + tt.tag + ` ` + tt.reason; !strings.Contains(log.String(), want) {
+			t.Errorf("prefer %s: log %q, want %q", tt.prefer, log.String(), want)
+		}
+	}
+	if _, err := DescribeRepository(context.Background(), f.repo, Options{StrictTags: true}); !errors.Is(err, ErrTagConflict) {
+		t.Errorf("strict tags: err %v, want %v", err, ErrTagConflict)
+	}
+}
+
+// TestFindBranchConcurrent concurrent branch walks through the locked storer find the same branch as
+// checking each branch one by one, run it with -race
+func TestFindBranchConcurrent(t *testing.T) {
+	for _, disk := range []bool{false, true} {
+		f := newFixture(t)
+		if disk {
+			f = newDiskFixture(t)
+		}
+		var forks []plumbing.Hash
+		for range 40 {
+			forks = append(forks, f.grow(3))
+		}
+		head := forks[20]
+		for i, fork := range forks {
+			f.detach(fork)
+			f.grow(2)
+			f.branch(fmt.Sprintf("feature/%02d", i))
+			if i%10 == 5 {
+				f.branch(fmt.Sprintf("release/%d", i))
+			}
+		}
+		f.switchTo(`main`)
+		f.detach(head)
+		if disk { // packfile readers are shared by the walks
+			f.repack()
+		}
+
+		for _, priority := range [][]string{nil, {`release/*`}, {`feature/3*`}, {`hotfix/*`, `feature/*`}} {
+			opts := Options{BranchPriority: priority}.withDefaults()
+			want := branchContaining(t, f.repo, head, newResolver(f.repo, opts).compareBranches)
+			for _, jobs := range []int{1, 4, 16} {
+				opts.Jobs = jobs
+				branch, err := newResolver(f.repo, opts).findBranch(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if branch != want {
+					t.Errorf("disk %v, priority %v, jobs %d: branch %q, want %q", disk, priority, jobs, branch, want)
+				}
+			}
+		}
+	}
+}
+
+// branchContaining get the first branch by compare whose tip is hash or descends from it, checked one by one
+func branchContaining(t *testing.T, repo *git.Repository, hash plumbing.Hash, compare func(a, b string) int) (branch string) {
+	t.Helper()
+	target, err := repo.CommitObject(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	branches, err := repo.Branches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = branches.ForEach(func(ref *plumbing.Reference) error {
+		tip, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		ok, err := target.IsAncestor(tip)
+		if err != nil {
+			return err
+		}
+		if name := ref.Name().Short(); (ok || tip.Hash == hash) && (branch == `` || compare(name, branch) < 0) {
+			branch = name
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if branch == `` {
+		t.Fatal(`no branch contains HEAD`)
+	}
+	return
+}
+
+// TestBranchOrderIndependent the branch of HEAD does not depend on the order branches are created in
+func TestBranchOrderIndependent(t *testing.T) {
+	for _, tt := range []struct {
+		names    []string
+		priority []string
+		want     string
+	}{
+		{[]string{`develop`, `feature/a`, `feature/b`, `release/1.0`, `release/0.9`, `wip`}, nil, `wip`},
+		{[]string{`develop`, `feature/a`, `master`, `release/1.0`, `wip`}, nil, `master`},
+		{[]string{`develop`, `feature/a`, `feature/b`, `release/1.0`, `release/0.9`, `wip`}, []string{`release/*`}, `release/0.9`},
+		{[]string{`develop`, `feature/a`, `master`, `release/1.0`, `wip`}, []string{`feature/*`, `develop`}, `feature/a`},
+	} {
+		for seed := range uint64(8) {
+			names := slices.Clone(tt.names)
+			rand.New(rand.NewPCG(seed, seed)).Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+			f := newDiskFixture(t)
+			head := f.commit(`init`, map[string]string{`main.go`: `1`})
+			for _, name := range names {
+				f.branch(name)
+			}
+			f.detach(head)
+			if err := f.repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(`main`)); err != nil {
+				t.Fatal(err)
+			}
+			opts := Options{BranchPriority: tt.priority}
+			if branch := f.describe(opts).Branch; branch != tt.want {
+				t.Errorf("branches created in order %v at HEAD: branch %q, want %q", names, branch, tt.want)
+			}
+			f.grow(1)
+			for _, name := range names {
+				f.branch(name)
+			}
+			f.detach(head)
+			if branch := f.describe(opts).Branch; branch != tt.want {
+				t.Errorf("branches created in order %v containing HEAD: branch %q, want %q", names, branch, tt.want)
+			}
+		}
+	}
+}
+
+// TestDefaultBranch the default branch is first among branches at or containing detached HEAD without priority:
+// the target of origin/HEAD if it exists locally, then init.defaultBranch of repository or global config, then main, then master
+func TestDefaultBranch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv(`HOME`, home)
+	t.Setenv(`USERPROFILE`, home)
+	t.Setenv(`XDG_CONFIG_HOME`, filepath.Join(home, `.config`))
+	for _, tt := range []struct {
+		name          string
+		branches      []string
+		originHead    string // target of origin/HEAD
+		defaultBranch string // init.defaultBranch of repository config
+		global        string // init.defaultBranch of global config
+		want          string
+	}{
+		{`origin/HEAD`, []string{`a`, `develop`, `main`, `master`, `trunk`}, `trunk`, `develop`, ``, `trunk`},
+		{`origin/HEAD without local branch`, []string{`a`, `develop`, `main`}, `trunk`, `develop`, ``, `develop`},
+		{`init.defaultBranch`, []string{`a`, `develop`, `main`, `master`}, ``, `develop`, ``, `develop`},
+		{`missing init.defaultBranch`, []string{`a`, `develop`, `main`}, ``, `trunk`, ``, `main`},
+		{`global init.defaultBranch`, []string{`a`, `main`, `trunk`}, ``, ``, `trunk`, `trunk`},
+		{`main`, []string{`a`, `develop`, `main`, `master`}, ``, ``, ``, `main`},
+		{`master`, []string{`a`, `develop`, `master`}, ``, ``, ``, `master`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			global := ``
+			if tt.global != `` {
+				global = "[init]\n\tdefaultBranch = " + tt.global + "\n"
+			}
+			if err := os.WriteFile(filepath.Join(home, `.gitconfig`), []byte(global), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f := newDiskFixture(t)
+			head := f.commit(`init`, map[string]string{`main.go`: `1`})
+			if tt.defaultBranch != `` {
+				cfg, err := f.repo.Config()
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg.Init.DefaultBranch = tt.defaultBranch
+				if err = f.repo.SetConfig(cfg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.originHead != `` {
+				target := plumbing.NewRemoteReferenceName(`origin`, tt.originHead)
+				for _, ref := range []*plumbing.Reference{
+					plumbing.NewHashReference(target, head),
+					plumbing.NewSymbolicReference(plumbing.NewRemoteHEADReferenceName(`origin`), target),
+				} {
+					if err := f.repo.Storer.SetReference(ref); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			for _, containing := range []bool{false, true} {
+				if containing {
+					f.detach(head)
+					f.grow(1)
+				}
+				for _, name := range tt.branches {
+					f.branch(name)
+				}
+				if !slices.Contains(tt.branches, `main`) {
+					if err := f.repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(`main`)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				f.detach(head)
+				if info := f.describe(Options{}); info.Branch != tt.want || info.MergedToDefault != `true` {
+					t.Errorf("branches %v containing HEAD %t: branch %q merged %q, want %q", tt.branches, containing, info.Branch, info.MergedToDefault, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestTagPrefixNFD tag created in NFD form, e.g. on macOS, matches -tag-prefix in NFC form
+func TestTagPrefixNFD(t *testing.T) {
+	nfd, nfc := norm.NFD.String(`café/`), norm.NFC.String(`café/`)
+	if nfd == nfc {
+		t.Fatal(`NFD and NFC forms are equal`)
+	}
+	f := newFixture(t)
+	f.commit(`c1`, map[string]string{`a`: `1`})
+	f.tag(nfd + `v1.0.0`)
+	f.commit(`c2`, map[string]string{`a`: `2`})
+	f.annotate(nfd+`v1.1.0`, `release`)
+	opts := Options{TagPrefix: nfc}
+
+	if info := f.describe(opts); info.Version != `v1.1.0` || info.Tag != nfd+`v1.1.0` {
+		t.Errorf("version %q tag %q, want v1.1.0 at NFD tag", info.Version, info.Tag)
+	}
+	releases, err := HistoryRepository(context.Background(), f.repo, false, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 2 || releases[0].Tag != nfd+`v1.0.0` || releases[1].Tag != nfd+`v1.1.0` {
+		t.Errorf("history %v, want both NFD tags", releases)
+	}
+	v, err := VerifyRepository(context.Background(), f.repo, `v1.1.0`, false, opts)
+	if err != nil {
+		t.Errorf("verify v1.1.0: %v (%v)", err, v)
+	}
+	f.commit(`c3`, map[string]string{`a`: `3`})
+	if info := f.describe(opts); !strings.HasPrefix(info.Version, `v1.1.0-2024`) {
+		t.Errorf("version %q, want pseudo-version after v1.1.0", info.Version)
+	}
+
+	if rest, ok := cutTagPrefix(nfd+`v1.0.0`, nfc); !ok || rest != `v1.0.0` {
+		t.Errorf("cutTagPrefix(NFD, NFC) = %q, %v", rest, ok)
+	}
+	if rest, ok := cutTagPrefix(nfc+`v1.0.0`, nfd); !ok || rest != `v1.0.0` {
+		t.Errorf("cutTagPrefix(NFC, NFD) = %q, %v", rest, ok)
+	}
+	// the prefix 'cafe' does not cut 'café' between the letter and its combining accent
+	if rest, ok := cutTagPrefix(nfd+`v1.0.0`, `cafe`); ok {
+		t.Errorf("cutTagPrefix(NFD, 'cafe') = %q, %v, want no match", rest, ok)
+	}
+}
@@ -0,0 +1,195 @@
+package version
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Level version level to bump
+type Level int
+
+// levels of version to bump
+const (
+	BumpPatch Level = iota
+	BumpMinor
+	BumpMajor
+)
+
+// semverReg match semantic version with optional prefix which does not end with digit or dot,
+// e.g. 'v1.2.3', 'release-1.2.3-rc.1+build.5', '1.2.3'
+var semverReg = regexp.MustCompile(`^(|.*[^0-9.])(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// String name of level: patch, minor, major
+func (l Level) String() string {
+	switch l {
+	case BumpMajor:
+		return `major`
+	case BumpMinor:
+		return `minor`
+	default:
+		return `patch`
+	}
+}
+
+// ParseLevel parse level name: major, minor, patch
+func ParseLevel(name string) (Level, error) {
+	for _, l := range []Level{BumpPatch, BumpMinor, BumpMajor} {
+		if name == l.String() {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid bump level %s, must be one of major, minor, patch", name)
+}
+
+// conventionalReg match header of conventional commit, e.g. 'feat(api)!: add users endpoint'
+var conventionalReg = regexp.MustCompile(`^([a-zA-Z]+)(?:\([^()\r\n]*\))?(!)?: `)
+
+// conventionalLevel get level to bump for conventional commit message: major for breaking changes marked by '!'
+// or 'BREAKING CHANGE:' footer, minor for 'feat', patch for the others including messages without the convention
+func conventionalLevel(message string) Level {
+	m := conventionalReg.FindStringSubmatch(message)
+	if m != nil && m[2] == `!` {
+		return BumpMajor
+	}
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, `BREAKING CHANGE:`) || strings.HasPrefix(line, `BREAKING-CHANGE:`) {
+			return BumpMajor
+		}
+	}
+	if m != nil && strings.EqualFold(m[1], `feat`) {
+		return BumpMinor
+	}
+	return BumpPatch
+}
+
+// Version semantic version parsed from tag
+type Version struct {
+	Prefix     string // text before version numbers, e.g. 'v', 'release-'
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string // prerelease without leading '-', e.g. 'rc.1'
+	Metadata   string // build metadata without leading '+', e.g. 'build.5'
+}
+
+// ParseVersion parse tag as semantic version with optional prefix
+func ParseVersion(tag string) (v Version, err error) {
+	m := semverReg.FindStringSubmatch(tag)
+	if m == nil {
+		err = fmt.Errorf("%w: %s", ErrInvalidVersion, tag)
+		return
+	}
+	v.Prefix, v.Prerelease, v.Metadata = m[1], m[5], m[6]
+	for i, n := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if *n, err = strconv.Atoi(m[i+2]); err != nil {
+			err = fmt.Errorf("%w: %s: %w", ErrInvalidVersion, tag, err)
+			return
+		}
+	}
+	return
+}
+
+// parseTag parse tag without tag prefix as semantic version, the version must be the whole tag
+// with an optional 'v' unless loose allows any text before it, e.g. 'release-1.2.3', 'deploy-eu-1.2.3'
+func parseTag(tag string, loose bool) (v Version, err error) {
+	v, err = ParseVersion(tag)
+	if err == nil && !loose && v.Prefix != `` && v.Prefix != `v` {
+		err = fmt.Errorf("%w: %s: text before version is only allowed with loose versions", ErrInvalidVersion, tag)
+	}
+	return
+}
+
+// String format version with its prefix, prerelease and metadata
+func (v Version) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if v.Prerelease != `` {
+		b.WriteString(`-` + v.Prerelease)
+	}
+	if v.Metadata != `` {
+		b.WriteString(`+` + v.Metadata)
+	}
+	return b.String()
+}
+
+// Compare compare version precedence with o, return -1, 0 or +1,
+// prefix and metadata are ignored
+func (v Version) Compare(o Version) int {
+	if c := cmp.Compare(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Bump get next version of level, a prerelease is bumped to its release if the level is already the lowest changed,
+// e.g. 'v1.2.3-rc.1' bumps patch to 'v1.2.3', 'v1.2.3' bumps minor to 'v1.3.0'
+func (v Version) Bump(level Level) Version {
+	pre := v.Prerelease != ``
+	v.Prerelease, v.Metadata = ``, ``
+	switch level {
+	case BumpMajor:
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			v.Major++
+		}
+		v.Minor, v.Patch = 0, 0
+	case BumpMinor:
+		if !pre || v.Patch != 0 {
+			v.Minor++
+		}
+		v.Patch = 0
+	default:
+		if !pre {
+			v.Patch++
+		}
+	}
+	return v
+}
+
+// comparePrerelease compare prerelease identifiers by semantic version precedence,
+// a version without prerelease has higher precedence
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == ``:
+		return 1
+	case b == ``:
+		return -1
+	}
+	as, bs := strings.Split(a, `.`), strings.Split(b, `.`)
+	for i := range min(len(as), len(bs)) {
+		an, bn := numericID(as[i]), numericID(bs[i])
+		switch {
+		case an && bn: // compare by value without parsing, so identifiers beyond int do not overflow
+			x, y := strings.TrimLeft(as[i], `0`), strings.TrimLeft(bs[i], `0`)
+			if c := cmp.Or(cmp.Compare(len(x), len(y)), strings.Compare(x, y)); c != 0 {
+				return c
+			}
+		case an: // numeric identifiers have lower precedence
+			return -1
+		case bn:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// numericID whether prerelease identifier is numeric, only ASCII digits, e.g. not '-5' or '+5' which strconv accepts
+func numericID(id string) bool {
+	return id != `` && strings.Trim(id, `0123456789`) == ``
+}
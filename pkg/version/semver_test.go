@@ -0,0 +1,95 @@
+package version
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestSemver parsing with optional prefix, precedence by semantic version rules without prefix and metadata, and bumps
+func TestSemver(t *testing.T) {
+	for _, tt := range []struct {
+		tag    string
+		prefix string
+		core   [3]int
+		pre    string
+		meta   string
+	}{
+		{`v1.2.3`, `v`, [3]int{1, 2, 3}, ``, ``},
+		{`1.2.3`, ``, [3]int{1, 2, 3}, ``, ``},
+		{`release-1.2.3`, `release-`, [3]int{1, 2, 3}, ``, ``},
+		{`deploy-eu-10.0.1-rc.10+build.5`, `deploy-eu-`, [3]int{10, 0, 1}, `rc.10`, `build.5`},
+		{`v0.0.0-alpha.-5`, `v`, [3]int{0, 0, 0}, `alpha.-5`, ``},
+	} {
+		v, err := ParseVersion(tt.tag)
+		if err != nil || v.Prefix != tt.prefix || [3]int{v.Major, v.Minor, v.Patch} != tt.core || v.Prerelease != tt.pre || v.Metadata != tt.meta {
+			t.Errorf("ParseVersion(%q) = %+v, %v", tt.tag, v, err)
+		}
+		if v.String() != tt.tag {
+			t.Errorf("ParseVersion(%q).String() = %q", tt.tag, v)
+		}
+	}
+	for _, tag := range []string{`v1.2`, `v01.2.3`, `v1.2.3.`, `v1.2.3-`, `v1.2.3-rc..1`, `v1.2.3+`, `1.2.3x`} {
+		if v, err := ParseVersion(tag); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("ParseVersion(%q) = %+v, %v, want %v", tag, v, err, ErrInvalidVersion)
+		}
+	}
+
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{`v1.2.3`, `1.2.3`, 0},
+		{`release-1.2.3`, `v1.2.3`, 0},
+		{`v1.2.3+build.1`, `v1.2.3+build.2`, 0},
+		{`v1.2.3-rc.1+zzz`, `v1.2.3-rc.1`, 0},
+		{`v1.2.3-rc.9`, `v1.2.3-rc.10`, -1},
+		{`v1.2.3-rc.10`, `v1.2.3-rc.9`, 1},
+		{`v1.2.3-rc.1`, `v1.2.3`, -1},
+		{`v1.2.3-alpha`, `v1.2.3-alpha.1`, -1},
+		{`v1.2.3-alpha.1`, `v1.2.3-alpha.beta`, -1},
+		{`v1.2.3-1`, `v1.2.3-alpha`, -1},
+		{`v1.2.3-alpha.1`, `v1.2.3-alpha.-5`, -1},
+		{`v1.2.3-alpha.-5`, `v1.2.3-alpha.-6`, -1},
+		{`v1.2.3-rc.99999999999999999999`, `v1.2.3-rc.100000000000000000000`, -1},
+		{`v1.2.9`, `v1.10.0`, -1},
+		{`v2.0.0-rc.1`, `v1.99.99`, 1},
+	} {
+		a, errA := ParseVersion(tt.a)
+		b, errB := ParseVersion(tt.b)
+		if errA != nil || errB != nil {
+			t.Fatalf("ParseVersion(%q, %q): %v, %v", tt.a, tt.b, errA, errB)
+		}
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s compare %s = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("%s compare %s = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		tag   string
+		level Level
+		want  string
+	}{
+		{`v1.2.3`, BumpPatch, `v1.2.4`},
+		{`v1.2.3`, BumpMinor, `v1.3.0`},
+		{`v1.2.3`, BumpMajor, `v2.0.0`},
+		{`1.2.3`, BumpPatch, `1.2.4`},
+		{`release-1.2.3`, BumpMinor, `release-1.3.0`},
+		{`v1.2.3+build.5`, BumpPatch, `v1.2.4`},
+		{`v1.2.3-rc.1`, BumpPatch, `v1.2.3`},
+		{`v1.2.3-rc.1`, BumpMinor, `v1.3.0`},
+		{`v1.3.0-rc.1`, BumpMinor, `v1.3.0`},
+		{`v2.0.0-rc.1+build.5`, BumpMajor, `v2.0.0`},
+		{`v2.0.1-rc.1`, BumpMajor, `v3.0.0`},
+	} {
+		v, err := ParseVersion(tt.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.Bump(tt.level).String(); got != tt.want {
+			t.Errorf("%s bump %s = %s, want %s", tt.tag, tt.level, got, tt.want)
+		}
+	}
+}
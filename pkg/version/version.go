@@ -0,0 +1,2618 @@
+// Package version resolve version information from git repository
+package version
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// errors of version resolution, check them with errors.Is
+var (
+	ErrNoRepository    = errors.New("no git repository")
+	ErrEmptyRepository = errors.New("empty git repository")
+	ErrDetachedHead    = errors.New("detached HEAD")
+	ErrShallowHistory  = errors.New("shallow history")
+	ErrPartialClone    = errors.New("object filtered out of partial clone")
+	ErrNoBranchFound   = errors.New("no branch found")
+	ErrInvalidVersion  = errors.New("invalid version")
+	ErrAmbiguousCommit = errors.New("ambiguous commit hash")
+	ErrVersionMismatch = errors.New("version mismatch")
+	ErrModuleMismatch  = errors.New("module major version mismatch")
+	ErrOutOfOrder      = errors.New("version tags out of order")
+	ErrTagConflict     = errors.New("conflicting version tags on one commit")
+	ErrTagExists       = errors.New("tag already exists")
+	ErrDirtyWorktree   = errors.New("worktree has uncommitted changes")
+	ErrBranchRefused   = errors.New("branch is not allowed to tag")
+	ErrNoPrerelease    = errors.New("no prerelease tag at HEAD")
+	ErrLimitExceeded   = errors.New("resource limit exceeded")
+)
+
+// Fields valid field names of Info
+var Fields = []string{`Version`, `Tag`, `Tags`, `Branch`, `ReleaseBranch`, `MergedToDefault`, `CommitTime`, `AuthorTime`, `Author`, `Committer`, `Subject`, `Ref`, `CommitID`, `BuildNumber`, `Commits`, `FirstCommit`, `RepoAge`, `Contributors`, `Source`, `Channel`, `TreeHash`, `Signature`, `Tagger`, `TagDate`, `SinceRelease`, `Repo`, `RepoURL`, `Describe`}
+
+// DefaultAbbrev abbreviated commit hash length in versions if Options.Abbrev is 0
+const DefaultAbbrev = 12
+
+// DefaultChannels default rules of Options.Channels
+var DefaultChannels = []string{`stable=@tag`, `stable=main`, `stable=master`, `rc=release/*`, `dev=*`}
+
+// Placeholders valid placeholders for Options.PseudoFormat
+var Placeholders = []string{`{ref}`, `{date}`, `{hash}`, `{distance}`, `{branch}`}
+
+// dateLayouts preset names for Options.DateFormat, 'unix' is handled separately
+var dateLayouts = map[string]string{
+	`compact`: `20060102150405`,
+	`rfc3339`: time.RFC3339,
+	`iso8601`: `2006-01-02 15:04:05 -0700`,
+}
+
+var placeholderReg = regexp.MustCompile(`\{[^{}]*}`)
+
+// sanitizeReg match characters replaced by Sanitize
+var sanitizeReg = regexp.MustCompile(`[^0-9a-z]+`)
+
+// commitReg match full or abbreviated commit hash
+var commitReg = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// dockerTagReg match characters replaced by DockerTag
+var dockerTagReg = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// maxDockerTag max length of Docker tag
+const maxDockerTag = 128
+
+// scpURLReg match scp-like git URL, e.g. 'git@github.com:yougg/gv.git'
+var scpURLReg = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]{2,}):([^/].*)$`)
+
+// Options control how the version information is resolved,
+// zero value of each option means its default.
+type Options struct {
+	Abbrev           int      // abbreviated commit hash length (4-40), default DefaultAbbrev in version and git's automatic length in Describe field and describe compat
+	DateFormat       string   // commit time format: compact (default), rfc3339, iso8601, unix or Go layout
+	TimeZone         string   // commit time zone: utc (default), local, committer
+	DateKind         string   // commit time source: committer (default), author
+	PseudoFormat     string   // pseudo-version layout with Placeholders, default '{ref}-{date}-{hash}'
+	Module           bool     // pseudo-version in Go module format
+	ShowBranch       bool     // use sanitized branch instead of 'v0.0.0' in pseudo-version if no tag found
+	ContentHash      bool     // use abbreviated tree hash of HEAD instead of commit hash in pseudo-version, identical trees get identical versions
+	BranchInVersion  bool     // pseudo-version with sanitized branch as prerelease segment after the base version bumped from tag, ignore PseudoFormat
+	Snapshot         bool     // Maven version: the tag at HEAD without prefix, or the patch bumped nearliest tag with '-SNAPSHOT'
+	SnapshotUnique   bool     // Maven unique snapshot version with timestamp and commits count since tag instead of '-SNAPSHOT'
+	CIBranch         string   // branch from CI env vars, e.g. GITHUB_REF_NAME, trusted for detached HEAD before searching branches containing HEAD
+	CITag            string   // tag from CI env vars, e.g. CI_COMMIT_TAG, used as the tag at HEAD without iterating tags if it points at HEAD
+	CICommit         string   // commit built by CI from env vars, e.g. CI_COMMIT_SHA, CIBranch and CITag are ignored with a warning if it is not HEAD
+	Ref              string   // revision to evaluate instead of HEAD, e.g. 'origin/release-1.8', 'v1.2.3', 'HEAD~3'
+	Commit           string   // full or abbreviated (at least 4 hex digits) commit hash to evaluate instead of HEAD
+	VersionFile      string   // slash separated path of file in repository, e.g. 'VERSION', its version is the base version if no tag is reachable
+	NotesRef         string   // notes ref whose note of HEAD overrides the version if it parses as a version, default 'refs/notes/gv'
+	CheckModule      bool     // fail with ErrModuleMismatch if major version differs from go.mod module path suffix, Describe only warns without it
+	PreferTagType    string   // tag type preferred among tags of one commit: any (default, semantic version order), annotated, lightweight
+	SignedOnly       bool     // only use annotated tags whose PGP signature verifies with Keyring, others are ignored with a warning
+	Keyring          string   // armored PGP public keyring to verify tag signatures, e.g. content of release key file
+	TagNamespaces    []string // only use tags under 'refs/tags/<namespace>/', e.g. 'releases', the namespace is removed from tag names
+	TagPrefix        string   // only use tags with the prefix, e.g. 'foo/', the prefix is removed in version
+	StrictTags       bool     // fail with ErrTagConflict if version tags of the chosen commit differ in major or minor version, only warn without it
+	Compat           string   // version compatible with another tool instead of gv rules: describe ('git describe --tags --always --dirty')
+	SemverOnly       bool     // only use tags which are semantic versions, others are ignored, e.g. 'sprint-42'
+	LooseVersions    bool     // tags with any text before the version after TagPrefix are semantic versions, e.g. 'release-1.2.3', default only 'v'
+	Paths            []string // slash separated paths in repository, e.g. 'services/foo', only count commits modifying any of them
+	Ignore           []string // gitignore style patterns of files whose changes do not modify Paths, e.g. '*.md'
+	ReleaseBranches  []string // glob patterns of release branches in path.Match syntax, e.g. 'release/*', pseudo-versions of other branches get '-dev.<branch>'
+	BranchPriority   []string // glob patterns in path.Match syntax ordering branches containing HEAD, e.g. 'main,release/*', the others follow by name
+	Channels         []string // release channel rules 'name=pattern' matched in order, pattern is branch glob in path.Match syntax, '@tag' for tag at HEAD or '*' for any, default DefaultChannels
+	DirtyHash        bool     // append '-dirty.<8 hex>' hash of uncommitted changes if worktree of HEAD is dirty
+	DirtyUntracked   bool     // include untracked files in DirtyHash
+	ChannelInVersion bool     // append channel to prerelease of version, e.g. v1.2.3-rc
+	BranchLength     int      // max length of sanitized branch embedded in version, default 40
+	SubjectLength    int      // max characters of commit subject, default 72
+	Contributors     bool     // count authors since the nearliest tag in Describe, the field is always computed on request
+	Submodules       bool     // resolve version of each submodule in .gitmodules of worktree in Describe
+	DiffStat         bool     // count changed files and lines between the nearliest tag and HEAD in Describe, only under Paths if they are set
+	Fields           []string // names in Fields which Describe resolves, nil for all, the others stay empty except Version, Tag, Tags and CommitID
+	BuildNumber      string   // build number counts commits: all (default, reachable from HEAD), since-tag, or an explicit number, e.g. '42'
+	BuildMetadata    string   // build metadata appended to semantic version after '+', e.g. 'build.42', it has no precedence
+	MaxDepth         int      // max commits to walk when counting commits, 0 means no limit
+	MaxCommits       int      // max commits of any walk, fail with ErrLimitExceeded beyond it instead of growing memory, 0 means no limit
+	MaxTags          int      // max tag references read, fail with ErrLimitExceeded beyond it, 0 means no limit
+	MaxBranches      int      // max branches walked to find the branch of detached HEAD, fail with ErrLimitExceeded beyond it, 0 means no limit
+	Jobs             int      // concurrent branch walks, default GOMAXPROCS
+	CacheMB          int      // object cache size in MiB when opening repository by path, default 96
+
+	SourceDate time.Time    // fixed time used instead of now, e.g. from SOURCE_DATE_EPOCH, it forces TimeZone to utc
+	Logger     *slog.Logger // logger for warnings, discard if nil
+}
+
+// Info version information at HEAD
+type Info struct {
+	Version         string
+	Tag             string
+	Tags            []string // all tags at HEAD, semantic versions first from the highest precedence
+	Branch          string
+	BranchSource    string // 'ci' if Branch is Options.CIBranch, 'reflog' if it is checked out from by detached HEAD, empty if it contains HEAD
+	ReleaseBranch   string // 'true' or 'false' whether Branch matches Options.ReleaseBranches, empty if they are not set
+	MergedToDefault string // 'true' or 'false' whether HEAD is reachable from the default branch, 'unknown' if it is not resolvable
+	CommitTime      string
+	AuthorTime      string
+	Author          string // 'Name <email>' of author of HEAD
+	Committer       string // 'Name <email>' of committer of HEAD
+	Subject         string // first line of HEAD commit message without control characters, cut to Options.SubjectLength
+	Ref             string // Options.Ref or Options.Commit evaluated instead of HEAD, empty for HEAD
+	CommitID        string
+	BuildNumber     string
+	Commits         string        // count of all commits reachable from HEAD
+	FirstCommit     string        // committer time of the oldest root commit reachable from HEAD
+	RepoAge         string        // duration since FirstCommit in seconds, e.g. '8760h0m0s'
+	Contributors    string        // count of distinct authors since the nearliest tag, only set with Options.Contributors
+	Authors         []Contributor // authors since the nearliest tag with their commits count, only set with Options.Contributors
+	TreeHash        string        // hash of root tree of HEAD, identical for commits with identical content
+	Channel         string        // release channel matched by Options.Channels, e.g. 'stable', 'rc', 'dev'
+	Tagger          string        // 'Name <email>' of annotated Tag, '<lightweight>' for lightweight Tag
+	TagDate         string        // tag date of annotated Tag, committer time of commit of lightweight Tag
+	SinceRelease    string        // humanized duration from TagDate to HEAD commit time, e.g. '37d', '5h', '0m'
+	Repo            string        // repository slug from origin URL, e.g. 'org/project', or name of worktree dir without origin
+	RepoURL         string        // normalized https URL of origin, empty without origin
+	Signed          string        // signature of Tag verified with Options.Keyring: 'yes', 'no' (lightweight or unsigned), 'invalid', empty without keyring
+	Signature       string        // signature details of Tag verified with Options.Keyring, e.g. 'good (Key 0xABCD1234, Release Bot <rel@corp>)' or 'unverified'
+	Describe        string        // same as 'git describe --tags --long --dirty', e.g. 'v1.2.3-4-gabcdef1-dirty', empty if no tag is reachable
+	Source          string        // 'note' if the version is overridden by the note in Options.NotesRef, empty otherwise
+	Submodules      []Submodule   // submodules in .gitmodules of worktree with their versions, only set with Options.Submodules
+	DiffStat        *DiffStat     // changes between trees of the nearliest tag and HEAD, only set with Options.DiffStat
+}
+
+// Contributor author of commits with the count of the commits
+type Contributor struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Commits int    `json:"commits"`
+}
+
+// DiffStat changed files with inserted and deleted lines
+type DiffStat struct {
+	Files      int `json:"files"`
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+}
+
+// String format as '23 (+1.2k/-340)'
+func (d DiffStat) String() string {
+	return fmt.Sprintf("%d (+%s/-%s)", d.Files, shortCount(d.Insertions), shortCount(d.Deletions))
+}
+
+// shortCount format count over 1000 with one decimal and 'k' or 'M', e.g. 1234 to '1.2k'
+func shortCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1e6), `.0`) + `M`
+	case n >= 1000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1e3), `.0`) + `k`
+	}
+	return strconv.Itoa(n)
+}
+
+// Submodule submodule of worktree with the version of its checked-out commit
+type Submodule struct {
+	Path    string `json:"path"`
+	Commit  string `json:"commit"`  // commit pinned in index of the superproject, empty if missing
+	Current string `json:"current"` // commit checked out in the submodule, empty if uninitialized
+	Status  string `json:"status"`  // 'ok' if Current is the pinned Commit, 'modified', 'uninitialized' or 'missing' from index
+	Version string `json:"version"` // version of Current resolved in the submodule repository, empty if it fails
+	Error   string `json:"error,omitempty"`
+}
+
+// Get get value of the field name in Fields, empty if the name is unknown,
+// Tags are joined with line breaks
+func (i Info) Get(name string) string {
+	switch name {
+	case `Version`:
+		return i.Version
+	case `Tag`:
+		return i.Tag
+	case `Signature`:
+		return i.Signature
+	case `Tagger`:
+		return i.Tagger
+	case `TagDate`:
+		return i.TagDate
+	case `SinceRelease`:
+		return i.SinceRelease
+	case `Repo`:
+		return i.Repo
+	case `RepoURL`:
+		return i.RepoURL
+	case `Tags`:
+		return strings.Join(i.Tags, "\n")
+	case `Branch`:
+		return i.Branch
+	case `ReleaseBranch`:
+		return i.ReleaseBranch
+	case `MergedToDefault`:
+		return i.MergedToDefault
+	case `CommitTime`:
+		return i.CommitTime
+	case `AuthorTime`:
+		return i.AuthorTime
+	case `Author`:
+		return i.Author
+	case `Committer`:
+		return i.Committer
+	case `Subject`:
+		return i.Subject
+	case `Ref`:
+		return i.Ref
+	case `CommitID`:
+		return i.CommitID
+	case `BuildNumber`:
+		return i.BuildNumber
+	case `Commits`:
+		return i.Commits
+	case `FirstCommit`:
+		return i.FirstCommit
+	case `RepoAge`:
+		return i.RepoAge
+	case `Contributors`:
+		return i.Contributors
+	case `Source`:
+		return i.Source
+	case `Channel`:
+		return i.Channel
+	case `TreeHash`:
+		return i.TreeHash
+	case `Describe`:
+		return i.Describe
+	}
+	return ``
+}
+
+// withDefaults fill the zero value options with defaults
+func (o Options) withDefaults() Options {
+	if o.DateFormat == `` {
+		o.DateFormat = `compact`
+	}
+	if o.TimeZone == `` || !o.SourceDate.IsZero() {
+		o.TimeZone = `utc`
+	}
+	if o.DateKind == `` {
+		o.DateKind = `committer`
+	}
+	if o.PseudoFormat == `` {
+		o.PseudoFormat = `{ref}-{date}-{hash}`
+	}
+	if o.BranchLength == 0 {
+		o.BranchLength = 40
+	}
+	if o.SubjectLength == 0 {
+		o.SubjectLength = 72
+	}
+	if o.BuildNumber == `` {
+		o.BuildNumber = `all`
+	}
+	if o.CacheMB == 0 {
+		o.CacheMB = 96
+	}
+	if o.PreferTagType == `` {
+		o.PreferTagType = `any`
+	}
+	if o.NotesRef == `` {
+		o.NotesRef = `refs/notes/gv`
+	}
+	if o.VersionFile != `` {
+		o.VersionFile = path.Clean(filepath.ToSlash(o.VersionFile))
+	}
+	var paths []string
+	for _, p := range o.Paths {
+		if p = path.Clean(filepath.ToSlash(p)); p != `.` {
+			paths = append(paths, p)
+		}
+	}
+	o.Paths = paths
+	if o.Jobs == 0 {
+		o.Jobs = runtime.GOMAXPROCS(0)
+	}
+	if o.Logger == nil {
+		o.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return o
+}
+
+// Validate check the options, zero value options are valid
+func (o Options) Validate() error {
+	o = o.withDefaults()
+	if o.Abbrev != 0 && (o.Abbrev < 4 || o.Abbrev > 40) {
+		return fmt.Errorf("invalid abbrev length %d, must be in range 4-40", o.Abbrev)
+	}
+	if !slices.Contains([]string{`utc`, `local`, `committer`}, o.TimeZone) {
+		return fmt.Errorf("invalid time zone %s, must be one of utc, local, committer", o.TimeZone)
+	}
+	if o.DateKind != `committer` && o.DateKind != `author` {
+		return fmt.Errorf("invalid date source %s, must be one of committer, author", o.DateKind)
+	}
+	if o.Compat != `` && o.Compat != `describe` {
+		return fmt.Errorf("invalid compat mode %s, must be describe", o.Compat)
+	}
+	for _, p := range placeholderReg.FindAllString(o.PseudoFormat, -1) {
+		if !slices.Contains(Placeholders, p) {
+			return fmt.Errorf("unknown placeholder %s in pseudo-format, valid: %s", p, strings.Join(Placeholders, `, `))
+		}
+	}
+	if o.Module && o.DateKind != `committer` {
+		return errors.New("Go module pseudo-version requires committer time")
+	}
+	if o.Module && o.BranchInVersion {
+		return errors.New("Go module pseudo-version can not include branch")
+	}
+	if o.Snapshot && (o.Module || o.BranchInVersion) {
+		return errors.New("Maven snapshot version can not be in Go module format or include branch")
+	}
+	if o.SnapshotUnique && !o.Snapshot {
+		return errors.New("unique snapshot version requires snapshot mode")
+	}
+	if o.Ref != `` && o.Commit != `` {
+		return errors.New("ref and commit can not be both set")
+	}
+	if o.Commit != `` && !commitReg.MatchString(o.Commit) {
+		return fmt.Errorf("invalid commit hash %s, must be 4-40 hex digits", o.Commit)
+	}
+	if o.SignedOnly && o.Keyring == `` {
+		return errors.New("signed only tags require a keyring")
+	}
+	for _, ns := range o.TagNamespaces {
+		if ns == `` || strings.HasPrefix(ns, `/`) || strings.HasSuffix(ns, `/`) || plumbing.NewTagReferenceName(ns).Validate() != nil {
+			return fmt.Errorf("invalid tag namespace %q", ns)
+		}
+	}
+	if !slices.Contains([]string{`any`, `annotated`, `lightweight`}, o.PreferTagType) {
+		return fmt.Errorf("invalid tag type %s, must be one of any, annotated, lightweight", o.PreferTagType)
+	}
+	if !strings.HasPrefix(o.NotesRef, `refs/notes/`) {
+		return fmt.Errorf("invalid notes ref %s, must start with refs/notes/", o.NotesRef)
+	}
+	if o.BuildNumber != `all` && o.BuildNumber != `since-tag` && strings.Trim(o.BuildNumber, `0123456789`) != `` {
+		return fmt.Errorf("invalid build number mode %s, must be one of all, since-tag, or a number", o.BuildNumber)
+	}
+	for _, id := range strings.Split(o.BuildMetadata, `.`) {
+		if o.BuildMetadata != `` && (id == `` || strings.Trim(id, `0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-`) != ``) {
+			return fmt.Errorf("invalid build metadata %s, must be dot separated identifiers of [0-9A-Za-z-]", o.BuildMetadata)
+		}
+	}
+	if min(o.MaxCommits, o.MaxTags, o.MaxBranches) < 0 {
+		return fmt.Errorf("invalid limits %d commits, %d tags, %d branches, must not be negative", o.MaxCommits, o.MaxTags, o.MaxBranches)
+	}
+	for _, name := range o.Fields {
+		if !slices.Contains(Fields, name) {
+			return fmt.Errorf("unknown field %s, valid: %s", name, strings.Join(Fields, `, `))
+		}
+	}
+	for _, p := range o.Paths {
+		if path.IsAbs(p) || p == `..` || strings.HasPrefix(p, `../`) {
+			return fmt.Errorf("invalid path %s, must be relative path in repository", p)
+		}
+	}
+	for _, rule := range o.Channels {
+		name, pattern, ok := strings.Cut(rule, `=`)
+		if !ok || name == `` || pattern == `` {
+			return fmt.Errorf("invalid channel rule %s, must be 'name=pattern'", rule)
+		}
+		if _, err := path.Match(pattern, ``); err != nil {
+			return fmt.Errorf("invalid channel pattern %s: %w", pattern, err)
+		}
+		if Sanitize(name, 0) != name {
+			return fmt.Errorf("invalid channel name %s, must be lower case letters, digits and '-'", name)
+		}
+	}
+	for _, pattern := range o.ReleaseBranches {
+		if _, err := path.Match(pattern, ``); err != nil {
+			return fmt.Errorf("invalid release branch pattern %s: %w", pattern, err)
+		}
+	}
+	for _, pattern := range o.BranchPriority {
+		if _, err := path.Match(pattern, ``); err != nil {
+			return fmt.Errorf("invalid branch priority pattern %s: %w", pattern, err)
+		}
+	}
+	if o.BranchLength < 0 {
+		return fmt.Errorf("invalid branch length %d, must not be negative", o.BranchLength)
+	}
+	if o.SubjectLength < 0 {
+		return fmt.Errorf("invalid subject length %d, must not be negative", o.SubjectLength)
+	}
+	if o.CacheMB < 0 {
+		return fmt.Errorf("invalid cache size %d MiB, must not be negative", o.CacheMB)
+	}
+	if o.Jobs < 0 {
+		return fmt.Errorf("invalid jobs %d, must not be negative", o.Jobs)
+	}
+	return nil
+}
+
+// Describe get version information at HEAD of repository, all fields or only Options.Fields,
+// repoPath is the repository worktree or its '.git' dir.
+func Describe(ctx context.Context, repoPath string, opts Options) (info Info, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return DescribeRepository(ctx, repo, opts)
+}
+
+// DescribeRepository get version information at HEAD of an opened repository, all fields or only Options.Fields,
+// the repository can be opened from any storage, e.g. in-memory or billy.Filesystem:
+//
+//	repo, err := git.Open(filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil)
+//
+// The returned info keeps the fields resolved before an error occurs,
+// e.g. the Version is the exact tag at HEAD if it is found before ctx is done.
+func DescribeRepository(ctx context.Context, repo *git.Repository, opts Options) (info Info, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	f := newFields(ctx, repo, opts.withDefaults())
+	need := func(names ...string) bool {
+		return opts.Fields == nil || slices.ContainsFunc(names, func(name string) bool { return slices.Contains(opts.Fields, name) })
+	}
+
+	info.Tag, err = f.exact()
+	if err != nil {
+		err = fmt.Errorf("find tag: %w", err)
+		return
+	}
+	if info.Tag != `` && !f.opts.Snapshot {
+		info.Version, _ = cutTagPrefix(info.Tag, f.opts.TagPrefix)
+	}
+	info.Tags, err = f.tags()
+	if err != nil {
+		err = fmt.Errorf("find tags: %w", err)
+		return
+	}
+	info.CommitID, err = f.r.headCommit()
+	if err != nil {
+		err = fmt.Errorf("get head commit: %w", err)
+		return
+	}
+	if need(`Ref`) {
+		info.Ref = cmp.Or(f.opts.Ref, f.opts.Commit)
+	}
+	if need(`TreeHash`) {
+		info.TreeHash, err = f.r.treeHash()
+		if err != nil {
+			err = fmt.Errorf("get tree hash: %w", err)
+			return
+		}
+	}
+	if need(`CommitTime`) {
+		info.CommitTime, err = f.commitTime(false)
+		if err != nil {
+			err = fmt.Errorf("get commit time: %w", err)
+			return
+		}
+	}
+	if need(`AuthorTime`) {
+		info.AuthorTime, err = f.commitTime(true)
+		if err != nil {
+			err = fmt.Errorf("get author time: %w", err)
+			return
+		}
+	}
+	if need(`Repo`, `RepoURL`) {
+		info.Repo, info.RepoURL, err = f.repoName()
+		if err != nil {
+			err = fmt.Errorf("get repository name: %w", err)
+			return
+		}
+	}
+	if need(`Author`, `Committer`) {
+		info.Author, info.Committer, err = f.r.commitPeople(info.CommitID)
+		if err != nil {
+			err = fmt.Errorf("get author and committer: %w", err)
+			return
+		}
+	}
+	if need(`Subject`) {
+		info.Subject, err = f.subject()
+		if err != nil {
+			err = fmt.Errorf("get commit subject: %w", err)
+			return
+		}
+	}
+	if need(`Branch`) {
+		info.Branch, err = f.headBranch()
+		if errors.Is(err, ErrNoBranchFound) {
+			f.opts.Logger.Warn("get head branch", `err`, err)
+		} else if err != nil {
+			err = fmt.Errorf("get head branch: %w", err)
+			return
+		}
+		info.BranchSource = f.r.branchSource
+	}
+	if need(`ReleaseBranch`) {
+		info.ReleaseBranch, err = f.releaseBranchValue()
+		if err != nil {
+			err = fmt.Errorf("check release branch: %w", err)
+			return
+		}
+	}
+	if need(`MergedToDefault`) {
+		info.MergedToDefault, err = f.r.mergedToDefault(f.ctx)
+		if err != nil {
+			err = fmt.Errorf("check merged to default branch: %w", err)
+			return
+		}
+	}
+	if need(`Channel`) {
+		info.Channel, err = f.channel()
+		if err != nil {
+			err = fmt.Errorf("match channel: %w", err)
+			return
+		}
+	}
+	info.Tag, err = f.tag()
+	if e := stopped(ctx, err); e != nil {
+		err = fmt.Errorf("find nearliest tag: %w", e)
+		return
+	}
+	if need(`Tagger`, `TagDate`) {
+		info.Tagger, info.TagDate, err = f.tagger()
+		if err != nil {
+			err = fmt.Errorf("get tagger: %w", err)
+			return
+		}
+	}
+	if need(`SinceRelease`) {
+		info.SinceRelease, err = f.sinceRelease()
+		if err != nil {
+			err = fmt.Errorf("get time since release: %w", err)
+			return
+		}
+	}
+	if need(`Signature`) {
+		if sig := f.r.tagSignature(info.Tag); sig.status != `` {
+			info.Signed, info.Signature = sig.status, sig.String()
+		}
+	}
+	info.Version, err = f.version()
+	if err != nil {
+		err = fmt.Errorf("format pseudo-version: %w", err)
+		return
+	}
+	if need(`Source`) {
+		if note, _ := f.note(); note != `` {
+			info.Source = `note`
+		}
+	}
+	if err = f.checkModule(info.Version); (errors.Is(err, ErrModuleMismatch) || errors.Is(err, ErrPartialClone)) && !f.opts.CheckModule {
+		f.opts.Logger.Warn("check go.mod module path", `err`, err)
+	} else if err != nil {
+		err = fmt.Errorf("check go.mod module path: %w", err)
+		return
+	}
+	if need(`Describe`) {
+		info.Describe, err = f.describe(true)
+		if err != nil {
+			err = fmt.Errorf("describe like git: %w", err)
+			return
+		}
+	}
+	if need(`BuildNumber`) {
+		info.BuildNumber, err = f.buildNumber()
+		if e := stopped(ctx, err); e != nil {
+			err = fmt.Errorf("count build number: %w", e)
+			return
+		}
+		if err != nil {
+			f.opts.Logger.Warn("count build number", `err`, err)
+		}
+	}
+	if f.opts.Contributors && need(`Contributors`) {
+		info.Authors, err = f.contributors()
+		if e := stopped(ctx, err); e != nil {
+			err = fmt.Errorf("count contributors: %w", e)
+			return
+		}
+		if err != nil {
+			f.opts.Logger.Warn("count contributors", `err`, err)
+		} else {
+			info.Contributors = strconv.Itoa(len(info.Authors))
+		}
+	}
+	if need(`Commits`, `FirstCommit`, `RepoAge`) {
+		info.Commits, info.FirstCommit, info.RepoAge, err = f.firstCommit()
+		if e := stopped(ctx, err); e != nil {
+			err = fmt.Errorf("find first commit: %w", e)
+			return
+		}
+		if err != nil {
+			f.opts.Logger.Warn("find first commit", `err`, err)
+		}
+	}
+	if f.opts.DiffStat {
+		info.DiffStat, err = f.diffStat()
+		if e := stopped(ctx, err); e != nil {
+			err = fmt.Errorf("count changes since tag: %w", e)
+			return
+		}
+		if err != nil {
+			f.opts.Logger.Warn("count changes since tag", `err`, err)
+		}
+	}
+	if f.opts.Submodules {
+		info.Submodules, err = f.submodules()
+		if e := stopped(ctx, err); e != nil {
+			err = fmt.Errorf("resolve submodules: %w", e)
+			return
+		}
+		if err != nil {
+			f.opts.Logger.Warn("resolve submodules", `err`, err)
+		}
+	}
+	return info, nil
+}
+
+// stopped get the error which ends Describe early with the partial result: ctx is done, or err exceeds a resource limit
+func stopped(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, ErrLimitExceeded) {
+		return err
+	}
+	return nil
+}
+
+// Field get single field value at HEAD of repository, only compute what the field needs,
+// repoPath is the repository worktree or its '.git' dir.
+func Field(ctx context.Context, repoPath, name string, opts Options) (value string, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return FieldRepository(ctx, repo, name, opts)
+}
+
+// FieldRepository get single field value at HEAD of an opened repository, only compute what the field needs
+func FieldRepository(ctx context.Context, repo *git.Repository, name string, opts Options) (value string, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	f := newFields(ctx, repo, opts.withDefaults())
+	if f.opts.CheckModule {
+		version, err := f.version()
+		if err != nil {
+			return ``, err
+		}
+		if err = f.checkModule(version); err != nil {
+			return ``, fmt.Errorf("check go.mod module path: %w", err)
+		}
+	}
+
+	switch name {
+	case `Version`:
+		return f.version()
+	case `Tag`:
+		return f.tag()
+	case `Tagger`:
+		tagger, _, err := f.tagger()
+		return tagger, err
+	case `TagDate`:
+		_, date, err := f.tagger()
+		return date, err
+	case `SinceRelease`:
+		return f.sinceRelease()
+	case `Repo`:
+		slug, _, err := f.repoName()
+		return slug, err
+	case `RepoURL`:
+		_, u, err := f.repoName()
+		return u, err
+	case `Signature`:
+		tag, err := f.tag()
+		if err != nil {
+			return ``, err
+		}
+		if sig := f.r.tagSignature(tag); sig.status != `` {
+			return sig.String(), nil
+		}
+		return ``, nil
+	case `Tags`:
+		tags, err := f.tags()
+		return strings.Join(tags, "\n"), err
+	case `BuildNumber`:
+		return f.buildNumber()
+	case `Commits`, `FirstCommit`, `RepoAge`:
+		commits, first, age, err := f.firstCommit()
+		switch name {
+		case `Commits`:
+			return commits, err
+		case `FirstCommit`:
+			return first, err
+		}
+		return age, err
+	case `Contributors`:
+		authors, err := f.contributors()
+		if err != nil {
+			return ``, err
+		}
+		return strconv.Itoa(len(authors)), nil
+	case `Branch`:
+		return f.headBranch()
+	case `ReleaseBranch`:
+		return f.releaseBranchValue()
+	case `MergedToDefault`:
+		return f.r.mergedToDefault(f.ctx)
+	case `CommitTime`:
+		return f.commitTime(false)
+	case `AuthorTime`:
+		return f.commitTime(true)
+	case `Author`, `Committer`:
+		commitID, err := f.r.headCommit()
+		if err != nil {
+			return ``, err
+		}
+		author, committer, err := f.r.commitPeople(commitID)
+		if name == `Author` {
+			return author, err
+		}
+		return committer, err
+	case `Subject`:
+		return f.subject()
+	case `Ref`:
+		return cmp.Or(f.opts.Ref, f.opts.Commit), nil
+	case `CommitID`:
+		return f.r.headCommit()
+	case `Channel`:
+		return f.channel()
+	case `TreeHash`:
+		return f.r.treeHash()
+	case `Describe`:
+		return f.describe(true)
+	case `Source`:
+		if note, err := f.note(); err != nil || note == `` {
+			return ``, err
+		}
+		return `note`, nil
+	}
+	return ``, fmt.Errorf("unknown field %q, valid fields: %s", name, strings.Join(Fields, `, `))
+}
+
+// RemoteURL get normalized fetch URL of remote name, e.g. 'origin', empty if the remote does not exist,
+// repoPath is the repository worktree or its '.git' dir.
+func RemoteURL(repoPath, name string) (string, error) {
+	repo, err := openRepo(gitDir(repoPath), Options{}.withDefaults().CacheMB)
+	if err != nil {
+		return ``, err
+	}
+	remote, err := repo.Remote(name)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return ``, nil
+	}
+	if err != nil {
+		return ``, fmt.Errorf("get remote %s: %w", name, err)
+	}
+	return NormalizeURL(remote.Config().URLs[0]), nil
+}
+
+// State get fingerprint of repository state which Describe depends on: HEAD and the commit it resolves to,
+// and size and modification time of config, packed-refs, index and the dirs under refs. It reads no reference
+// or index entry beyond HEAD, so it is cheap to check whether a cached result is still valid on repositories
+// with many refs and files. git updates refs by renaming lock files, which changes the modification time of their dirs.
+// Worktree edits not yet in the index, untracked files and checked-out commits of submodules are not covered.
+// repoPath is the repository worktree or its '.git' dir.
+func State(repoPath string) (string, error) {
+	repo, err := openRepo(gitDir(repoPath), Options{}.withDefaults().CacheMB)
+	if err != nil {
+		return ``, err
+	}
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return ``, fmt.Errorf("%w: repository %s is not on disk", ErrNoRepository, repoPath)
+	}
+	fs := storage.Filesystem()
+	h := sha256.New()
+	if head, err := repo.Storer.Reference(plumbing.HEAD); err == nil {
+		fmt.Fprintln(h, head)
+	}
+	if head, err := repo.Reference(plumbing.HEAD, true); err == nil {
+		fmt.Fprintln(h, head.Hash())
+	}
+	stat := func(name string) (os.FileInfo, error) {
+		fi, err := fs.Lstat(name)
+		if err != nil {
+			fmt.Fprintln(h, name, `missing`)
+			return nil, err
+		}
+		fmt.Fprintln(h, name, fi.Size(), fi.ModTime().UnixNano())
+		return fi, nil
+	}
+	for _, name := range []string{`config`, `packed-refs`, `index`} {
+		_, _ = stat(name)
+	}
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		if _, err := stat(dir); err != nil {
+			return nil
+		}
+		entries, err := fs.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", dir, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				if err = walk(fs.Join(dir, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err = walk(`refs`); err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NormalizeURL normalize git remote URL to https URL without credentials, ssh port and '.git' suffix,
+// e.g. 'git@github.com:yougg/gv.git' to 'https://github.com/yougg/gv', local paths are kept as is
+func NormalizeURL(raw string) string {
+	s := raw
+	if !strings.Contains(s, `://`) {
+		m := scpURLReg.FindStringSubmatch(s)
+		if m == nil {
+			return raw
+		}
+		s = `ssh://` + m[1] + `/` + m[2]
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == `` {
+		return raw
+	}
+	switch u.Scheme {
+	case `ssh`, `git`, `git+ssh`, `ssh+git`:
+		u.Scheme, u.Host = `https`, u.Hostname()
+		if strings.Contains(u.Host, `:`) {
+			u.Host = `[` + u.Host + `]` // IPv6 address
+		}
+	}
+	u.User = nil
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, `/`), `.git`)
+	return u.String()
+}
+
+// RepoSlug get repository path of git remote URL without leading and trailing '/' and '.git' suffix,
+// e.g. 'org/project' or 'group/subgroup/project' on GitLab, Bitbucket Server 'scm/' prefix is removed,
+// the base name of local paths
+func RepoSlug(raw string) string {
+	u, err := url.Parse(NormalizeURL(raw))
+	if err != nil || u.Host == `` {
+		local := strings.ReplaceAll(filepath.ToSlash(raw), `\`, `/`) // Windows path of remote read on any OS
+		return strings.TrimSuffix(path.Base(strings.TrimSuffix(local, `/`)), `.git`)
+	}
+	slug := strings.Trim(u.Path, `/`)
+	return strings.TrimPrefix(slug, `scm/`)
+}
+
+// ChangedCommit commit modifying Options.Paths
+type ChangedCommit struct {
+	ID      string
+	Subject string // first line of commit message
+}
+
+// Changed get the nearliest tag reachable from HEAD and the commits modifying Options.Paths since the tag,
+// in breadth-first order from HEAD, repoPath is the repository worktree or its '.git' dir.
+func Changed(ctx context.Context, repoPath string, opts Options) (tag string, commits []ChangedCommit, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return ChangedRepository(ctx, repo, opts)
+}
+
+// ChangedRepository get the nearliest tag reachable from HEAD of an opened repository
+// and the commits modifying Options.Paths since the tag
+func ChangedRepository(ctx context.Context, repo *git.Repository, opts Options) (tag string, commits []ChangedCommit, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	r := newResolver(repo, opts.withDefaults())
+	if tag, err = r.nearliestTag(ctx); err != nil {
+		err = fmt.Errorf("find nearliest tag: %w", err)
+		return
+	}
+	var hashes []plumbing.Hash
+	if tag == `` {
+		if err = r.walk(ctx, nil); err != nil {
+			return
+		}
+		hashes = r.order
+	} else {
+		var base *plumbing.Hash
+		if base, err = r.repo.ResolveRevision(plumbing.Revision(r.tagRefName(tag))); err != nil {
+			err = fmt.Errorf("resolve tag %s: %w", tag, err)
+			return
+		}
+		if hashes, err = r.commitsSince(ctx, *base); err != nil {
+			return
+		}
+	}
+	for _, hash := range hashes {
+		var touched bool
+		if touched, err = r.touches(hash); err != nil {
+			return
+		}
+		if !touched {
+			continue
+		}
+		var commit *object.Commit
+		if commit, err = repo.CommitObject(hash); err != nil {
+			err = fmt.Errorf("get commit %s: %w", hash, err)
+			return
+		}
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		commits = append(commits, ChangedCommit{ID: hash.String(), Subject: subject})
+	}
+	return
+}
+
+// Release semantic version tag in History
+type Release struct {
+	Tag       string `json:"tag"`
+	CommitID  string `json:"commit"`
+	Date      string `json:"date"`      // tagger time of annotated tag or commit time of lightweight tag, in Options.DateFormat
+	Annotated bool   `json:"annotated"` // annotated tag, lightweight if false
+	Commits   int    `json:"commits"`   // commits reachable from the tag but not from the previous release, all for the first release
+}
+
+// History get all semantic version tags with Options.TagPrefix in repository,
+// sorted by version precedence, or by date if byDate is true,
+// repoPath is the repository worktree or its '.git' dir.
+func History(ctx context.Context, repoPath string, byDate bool, opts Options) (releases []Release, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return HistoryRepository(ctx, repo, byDate, opts)
+}
+
+// HistoryRepository get all semantic version tags with Options.TagPrefix in an opened repository
+func HistoryRepository(ctx context.Context, repo *git.Repository, byDate bool, opts Options) (releases []Release, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	opts = opts.withDefaults()
+	r := newResolver(repo, opts)
+	tags, err := r.releaseTags(ctx)
+	if err != nil {
+		return
+	}
+	slices.SortStableFunc(tags, func(a, b releaseTag) int {
+		if byDate {
+			if c := a.when.Compare(b.when); c != 0 {
+				return c
+			}
+		}
+		if c := a.version.Compare(b.version); c != 0 {
+			return c
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	var previous map[plumbing.Hash]bool
+	for _, tag := range tags {
+		var commits int
+		if commits, previous, err = r.countSince(ctx, tag.commit, previous); err != nil {
+			err = fmt.Errorf("count commits of %s: %w", tag.name, err)
+			return
+		}
+		releases = append(releases, Release{
+			Tag:       tag.name,
+			CommitID:  tag.commit.String(),
+			Date:      commitDate(inZone(tag.when, opts.TimeZone), opts.DateFormat),
+			Annotated: tag.annotated,
+			Commits:   commits,
+		})
+	}
+	return
+}
+
+// OrderViolation tag of higher version on an ancestor of the commit of a lower version tag
+type OrderViolation struct {
+	Ancestor       string `json:"ancestor"` // the higher version tag, e.g. 'v1.4.1'
+	AncestorCommit string `json:"ancestorCommit"`
+	Tag            string `json:"tag"` // the lower version tag descending from Ancestor, e.g. 'v1.4.0'
+	TagCommit      string `json:"tagCommit"`
+}
+
+// String explain the violation, e.g. 'v1.4.0 (abcdef123456) descends from higher version v1.4.1 (123456abcdef)'
+func (v OrderViolation) String() string {
+	return fmt.Sprintf("%s (%s) descends from higher version %s (%s)", v.Tag, v.TagCommit[:min(12, len(v.TagCommit))],
+		v.Ancestor, v.AncestorCommit[:min(12, len(v.AncestorCommit))])
+}
+
+// CheckOrder check semantic version tags with Options.TagPrefix never descend from a tag of higher version,
+// only tags dated since are checked if it is not zero, return the violations with ErrOutOfOrder if any,
+// one per tag with the highest version among its ancestors. repoPath is the repository worktree or its '.git' dir.
+func CheckOrder(ctx context.Context, repoPath string, since time.Time, opts Options) (violations []OrderViolation, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return CheckOrderRepository(ctx, repo, since, opts)
+}
+
+// CheckOrderRepository check semantic version tags in an opened repository never descend from a tag of higher version
+func CheckOrderRepository(ctx context.Context, repo *git.Repository, since time.Time, opts Options) (violations []OrderViolation, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	r := newResolver(repo, opts.withDefaults())
+	tags, err := r.releaseTags(ctx)
+	if err != nil {
+		return
+	}
+	tags = slices.DeleteFunc(tags, func(t releaseTag) bool { return t.when.Before(since) })
+	slices.SortFunc(tags, func(a, b releaseTag) int {
+		return cmp.Or(a.version.Compare(b.version), strings.Compare(a.name, b.name))
+	})
+	if violations, err = r.orderViolations(ctx, tags, since); err != nil {
+		return
+	}
+	if len(violations) > 0 {
+		err = fmt.Errorf("%w: %d tags descend from higher versions", ErrOutOfOrder, len(violations))
+	}
+	return
+}
+
+// ModuleProblem tag which breaks Go module version rules for a module in the repository
+type ModuleProblem struct {
+	Module string `json:"module"` // module path in go.mod
+	Dir    string `json:"dir"`    // slash separated dir of go.mod in repository, '.' for the root
+	Tag    string `json:"tag"`
+	Reason string `json:"reason"`
+}
+
+// String explain the problem, e.g. 'tag v2.0.0 of example.com/m (.): major version v2 requires module path example.com/m/v2'
+func (p ModuleProblem) String() string {
+	return fmt.Sprintf("tag %s of %s (%s): %s", p.Tag, p.Module, p.Dir, p.Reason)
+}
+
+// ModuleTagPrefix get prefix of version tags Go expects for module path in slash separated dir of repository:
+// the dir with '/', without the trailing major version dir of the module path, e.g. 'services/foo/' for
+// module 'example.com/m/services/foo/v2' in 'services/foo/v2', empty for the root dir '.'
+func ModuleTagPrefix(modPath, dir string) string {
+	if _, pathMajor, ok := module.SplitPathVersion(modPath); ok && pathMajor != `` && path.Base(dir) == pathMajor[1:] {
+		dir = path.Dir(dir)
+	}
+	if dir == `.` || dir == `` {
+		return ``
+	}
+	return dir + `/`
+}
+
+// CheckModules check version tags against modules of go.mod files in HEAD tree: tags of each module,
+// 'v1.2.3' for the root module and '<dir>/v1.2.3' for nested modules, must match the major version
+// of its module path, e.g. '/v2' suffix for v2, no suffix for v0 and v1, lower majors are left as history.
+// Tags which look like versions of a nested module without the '<dir>/' prefix Go expects are reported too,
+// e.g. 'foo-v1.2.3' for module in 'services/foo'.
+// Return the problems with ErrModuleMismatch if any. repoPath is the repository worktree or its '.git' dir.
+func CheckModules(ctx context.Context, repoPath string, opts Options) (problems []ModuleProblem, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return CheckModulesRepository(ctx, repo, opts)
+}
+
+// CheckModulesRepository check version tags against modules of go.mod files in an opened repository
+func CheckModulesRepository(ctx context.Context, repo *git.Repository, opts Options) (problems []ModuleProblem, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	r := newResolver(repo, opts.withDefaults())
+	modules, err := r.modules()
+	if err != nil {
+		return
+	}
+	iter, err := r.tagRefs()
+	if err != nil {
+		return
+	}
+	var tags []string
+	if err = iter.ForEach(func(reference *plumbing.Reference) error {
+		tags = append(tags, r.tagName(reference.Name()))
+		return ctx.Err()
+	}); err != nil {
+		return
+	}
+	slices.Sort(tags)
+	// tags of any module, other modules' tags are not misplaced tags of a nested module
+	owned := func(tag string) bool {
+		for _, m := range modules {
+			if v, ok := strings.CutPrefix(tag, m.tagPrefix()); ok && semver.IsValid(v) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, m := range modules {
+		_, pathMajor, _ := module.SplitPathVersion(m.path)
+		major, _ := strconv.Atoi(strings.TrimLeft(pathMajor, `/.v`))
+		prefix := m.tagPrefix()
+		for _, tag := range tags {
+			if v, ok := strings.CutPrefix(tag, prefix); ok && semver.IsValid(v) {
+				// tags of lower majors are history before the module path got its major suffix
+				if n, _ := strconv.Atoi(semver.Major(v)[1:]); n < max(major, 1) {
+					continue
+				}
+				if err := module.CheckPathMajor(v, pathMajor); err != nil {
+					reason := fmt.Sprintf("major version %s requires module path %s/%s", semver.Major(v), m.path, semver.Major(v))
+					if pathMajor != `` {
+						reason = fmt.Sprintf("major version %s does not match %s of module path", semver.Major(v), pathMajor)
+					}
+					problems = append(problems, ModuleProblem{Module: m.path, Dir: m.dir, Tag: tag, Reason: reason})
+				}
+				continue
+			}
+			if prefix == `` || owned(tag) {
+				continue
+			}
+			// e.g. 'foo-v1.2.3', 'foo/1.2.3' or 'foo/v1.2.3' for module in 'services/foo'
+			name := path.Base(strings.TrimSuffix(prefix, `/`))
+			if v, err := ParseVersion(tag); err == nil {
+				if p := strings.TrimRight(strings.TrimSuffix(v.Prefix, `v`), `-_/@`); p != name && !strings.HasSuffix(p, `/`+name) {
+					continue
+				}
+				problems = append(problems, ModuleProblem{Module: m.path, Dir: m.dir, Tag: tag,
+					Reason: fmt.Sprintf("tag of nested module must be %sv%d.%d.%d", prefix, v.Major, v.Minor, v.Patch)})
+			}
+		}
+	}
+	if len(problems) > 0 {
+		err = fmt.Errorf("%w: %d tags break module versioning", ErrModuleMismatch, len(problems))
+	}
+	return
+}
+
+// Verification result of Verify, the tag of version compared with HEAD
+type Verification struct {
+	Tag       string // tag of the version, empty if not found
+	TagCommit string
+	CommitID  string // commit of HEAD, Options.Ref or Options.Commit
+	Ahead     int    // commits reachable from HEAD but not from the tag
+	Behind    int    // commits reachable from the tag but not from HEAD
+}
+
+// String explain the verification, e.g. 'HEAD is 4 commits ahead of v1.8.2'
+func (v Verification) String() string {
+	switch {
+	case v.Tag == ``:
+		return `no tag found`
+	case v.Ahead == 0 && v.Behind == 0:
+		return `HEAD is at ` + v.Tag
+	case v.Behind == 0:
+		return fmt.Sprintf("HEAD is %d commits ahead of %s", v.Ahead, v.Tag)
+	case v.Ahead == 0:
+		return fmt.Sprintf("HEAD is %d commits behind %s", v.Behind, v.Tag)
+	}
+	return fmt.Sprintf("HEAD and %s have diverged, %d commits ahead and %d commits behind", v.Tag, v.Ahead, v.Behind)
+}
+
+// Verify check that version is a tag with Options.TagPrefix in repository and HEAD is the tagged commit,
+// or only that the tag is an ancestor of HEAD if reachable is true, return ErrVersionMismatch otherwise.
+// The version matches the tag of the same name, or the semantic version tag of the same precedence,
+// e.g. '1.8.2' matches tag 'v1.8.2'. repoPath is the repository worktree or its '.git' dir.
+func Verify(ctx context.Context, repoPath, version string, reachable bool, opts Options) (v Verification, err error) {
+	repo, err := openRepo(gitDir(repoPath), opts.withDefaults().CacheMB)
+	if err != nil {
+		return
+	}
+	return VerifyRepository(ctx, repo, version, reachable, opts)
+}
+
+// VerifyRepository check that version is a tag in an opened repository and HEAD is the tagged commit,
+// or only that the tag is an ancestor of HEAD if reachable is true
+func VerifyRepository(ctx context.Context, repo *git.Repository, version string, reachable bool, opts Options) (v Verification, err error) {
+	if repo == nil {
+		err = fmt.Errorf("%w: nil repository", ErrNoRepository)
+		return
+	}
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	r := newResolver(repo, opts.withDefaults())
+	head, err := r.headRef()
+	if err != nil {
+		return
+	}
+	v.CommitID = head.Hash().String()
+	tag, hash, err := r.versionTag(ctx, version)
+	if err != nil {
+		return
+	}
+	if tag == `` {
+		err = fmt.Errorf("%w: no tag of version %s", ErrVersionMismatch, version)
+		return
+	}
+	v.Tag, v.TagCommit = tag, hash.String()
+	_, tagAncestors, err := r.countSince(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	var headAncestors map[plumbing.Hash]bool
+	if v.Ahead, headAncestors, err = r.countSince(ctx, head.Hash(), tagAncestors); err != nil {
+		return
+	}
+	for h := range tagAncestors {
+		if !headAncestors[h] {
+			v.Behind++
+		}
+	}
+	if v.Behind > 0 || v.Ahead > 0 && !reachable {
+		err = fmt.Errorf("%w: %s", ErrVersionMismatch, v)
+	}
+	return
+}
+
+// SetNote override version of HEAD (or Options.Ref, Options.Commit) with note in Options.NotesRef,
+// remove the override if version is empty, the notes commit is signed with user in git config.
+// repoPath is the repository worktree or its '.git' dir.
+func SetNote(repoPath, version string, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if version != `` {
+		if _, err := ParseVersion(version); err != nil {
+			return err
+		}
+	}
+	opts = opts.withDefaults()
+	repo, err := openRepo(gitDir(repoPath), opts.CacheMB)
+	if err != nil {
+		return err
+	}
+	return newResolver(repo, opts).setNote(opts.NotesRef, version, signature(repo, opts))
+}
+
+// signature get signature of user in git config at now or Options.SourceDate, 'gv' if the user is not set
+func signature(repo *git.Repository, opts Options) object.Signature {
+	sig := object.Signature{Name: `gv`, When: time.Now()}
+	if !opts.SourceDate.IsZero() {
+		sig.When = opts.SourceDate
+	}
+	if cfg, err := repo.ConfigScoped(config.GlobalScope); err == nil && cfg.User.Name != `` {
+		sig.Name, sig.Email = cfg.User.Name, cfg.User.Email
+	}
+	return sig
+}
+
+// TagOptions options to create version tags
+type TagOptions struct {
+	Branches []string // glob patterns in path.Match syntax of branches allowed to tag, default DefaultTagBranches
+	Remote   string   // remote to push the tag to, no push if empty
+	Attempts int      // tries when a concurrent run pushes the same tag first, default 3
+}
+
+// DefaultTagBranches branches allowed to tag by default
+var DefaultTagBranches = []string{`main`, `master`}
+
+// TagResult result of AutoTag
+type TagResult struct {
+	Tag      string `json:"tag"`      // created tag, or the tag at HEAD if already tagged
+	Previous string `json:"previous"` // nearliest tag the version is bumped from, empty for the first release
+	Level    string `json:"level"`    // bumped level from conventional commits: major, minor, patch
+	Commits  int    `json:"commits"`  // commits since Previous
+	Created  bool   `json:"created"`
+	Pushed   bool   `json:"pushed"`
+	Reason   string `json:"reason,omitempty"` // why no tag is created: 'already tagged', 'no commits since last tag'
+}
+
+// AutoTag tag HEAD with the next version bumped from the nearliest tag by conventional commits since it:
+// major for breaking changes ('!' after type or 'BREAKING CHANGE:' footer), minor for 'feat', patch for the others,
+// breaking changes only bump minor before v1.0.0. The annotated tag is pushed to TagOptions.Remote if set.
+// Nothing is done if HEAD has a version tag or no commit is made since the nearliest tag.
+// Fail with ErrBranchRefused on branches not in TagOptions.Branches, ErrDirtyWorktree with uncommitted changes.
+// If a concurrent run pushes the same tag first, the local tag is removed, remote tags are fetched and the version
+// is resolved again, up to TagOptions.Attempts times. repoPath is the repository worktree or its '.git' dir.
+func AutoTag(ctx context.Context, repoPath string, to TagOptions, opts Options) (res TagResult, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	for _, pattern := range to.Branches {
+		if _, err = path.Match(pattern, ``); err != nil {
+			return res, fmt.Errorf("invalid tag branch pattern %s: %w", pattern, err)
+		}
+	}
+	opts = opts.withDefaults()
+	repo, err := openRepo(gitDir(repoPath), opts.CacheMB)
+	if err != nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		var r *resolver
+		var ref string
+		if r, ref, res, err = autoTag(ctx, repo, to, opts); err != nil || !res.Created || to.Remote == `` {
+			return
+		}
+		if res.Pushed, err = r.publishTag(ctx, to.Remote, ref); err == nil {
+			return
+		}
+		res.Created = false
+		if !errors.Is(err, ErrTagExists) || attempt >= cmp.Or(to.Attempts, 3) {
+			return
+		}
+		opts.Logger.Warn("tag is pushed by another run, resolve version again", `tag`, res.Tag, `attempt`, attempt, `err`, err)
+		if err = r.fetchTags(ctx, to.Remote); err != nil {
+			return
+		}
+	}
+}
+
+// BumpOptions options of Bump
+type BumpOptions struct {
+	Level      Level  // level bumped from the nearliest tag
+	Prerelease string // prerelease series, e.g. 'rc' for 'v1.9.0-rc.1', its counter follows the highest existing tag of the series
+	DryRun     bool   // only resolve the version without creating the tag
+
+	To             string // explicit version instead of bumping Level, e.g. 'v3.0.0', it must be higher than all version tags
+	AllowDowngrade bool   // allow To lower than or equal to existing version tags, e.g. to renumber releases
+}
+
+// Bump tag HEAD with the version bumped from the nearliest tag, e.g. 'v1.9.0' bumping minor from 'v1.8.2',
+// or the next prerelease of a series with the counter after the highest existing tag of the same release and series,
+// e.g. 'v1.9.0-rc.1', then 'v1.9.0-rc.2'. Other prerelease series of the release are warned as their order may differ.
+// BumpOptions.To is tagged as is after validation: fail with ErrInvalidVersion unless it is 'vX.Y.Z' with optional
+// prerelease and metadata, ErrOutOfOrder naming the existing version tag with TagPrefix it does not exceed,
+// and ErrModuleMismatch if its major version differs from the module path in go.mod. The tag is pushed to TagOptions.Remote if set. repoPath is the repository worktree or its '.git' dir.
+func Bump(ctx context.Context, repoPath string, bo BumpOptions, to TagOptions, opts Options) (res TagResult, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	if bo.Prerelease != `` {
+		if _, err = ParseVersion(`0.0.0-` + bo.Prerelease + `.1`); err != nil {
+			return res, fmt.Errorf("invalid prerelease series %s: %w", bo.Prerelease, err)
+		}
+	}
+	opts = opts.withDefaults()
+	repo, err := openRepo(gitDir(repoPath), opts.CacheMB)
+	if err != nil {
+		return
+	}
+	f := newFields(ctx, repo, opts)
+	r := f.r
+	if res.Previous, err = r.nearliestTag(ctx); err != nil {
+		return res, fmt.Errorf("find nearliest tag: %w", err)
+	}
+	if bo.To != `` {
+		if res.Tag, err = f.bumpTo(bo.To, bo.AllowDowngrade); err != nil || bo.DryRun {
+			return
+		}
+		return r.tagHead(ctx, res, to.Remote, signature(repo, opts))
+	}
+	base := Version{Prefix: `v`}
+	if res.Previous != `` {
+		if base, err = r.tagVersion(res.Previous); err != nil {
+			return res, fmt.Errorf("nearliest tag: %w", err)
+		}
+	}
+	res.Level = bo.Level.String()
+	next := base.Bump(bo.Level)
+	if bo.Prerelease != `` {
+		if next, err = r.nextPrerelease(ctx, next, bo.Prerelease); err != nil {
+			return
+		}
+	}
+	res.Tag = r.prefix + next.String()
+	if bo.DryRun {
+		return
+	}
+	return r.tagHead(ctx, res, to.Remote, signature(repo, opts))
+}
+
+// bumpTo validate explicit version to of Bump, return its tag name
+func (f *fields) bumpTo(to string, allowDowngrade bool) (tag string, err error) {
+	v, err := parseTag(to, false)
+	if err != nil {
+		return
+	}
+	if v.Prefix != `v` {
+		return ``, fmt.Errorf("%w: %s: version must start with 'v'", ErrInvalidVersion, to)
+	}
+	if !allowDowngrade {
+		releases, err := f.r.releaseTags(f.ctx)
+		if err != nil {
+			return ``, fmt.Errorf("get version tags: %w", err)
+		}
+		var highest Version
+		for _, release := range releases { // name the highest conflicting tag
+			if release.version.Compare(v) >= 0 && (tag == `` || release.version.Compare(highest) > 0) {
+				tag, highest = release.name, release.version
+			}
+		}
+		if tag != `` {
+			return ``, fmt.Errorf("%w: %s is not higher than existing tag %s", ErrOutOfOrder, to, tag)
+		}
+	}
+	if err = f.checkModule(to); err != nil {
+		return
+	}
+	return f.r.prefix + to, nil
+}
+
+// tagHead create annotated tag res.Tag at HEAD and push it to remote if set
+func (r *resolver) tagHead(ctx context.Context, res TagResult, remote string, sig object.Signature) (TagResult, error) {
+	h, err := r.headRef()
+	if err != nil {
+		return res, err
+	}
+	ref, err := r.createTag(res.Tag, h.Hash(), `Release `+strings.TrimPrefix(res.Tag, r.prefix), sig)
+	if err != nil {
+		return res, err
+	}
+	res.Created = true
+	if remote != `` {
+		if res.Pushed, err = r.publishTag(ctx, remote, ref); err != nil {
+			res.Created = false
+		}
+	}
+	return res, err
+}
+
+// Promote tag the commit of the highest prerelease tag at HEAD with its release version,
+// e.g. 'v2.0.0' for 'v2.0.0-rc.3', and push it to TagOptions.Remote if set, nothing is created if dryRun is true.
+// Fail with ErrNoPrerelease if HEAD has no prerelease tag, ErrTagExists if the release tag is on another commit,
+// nothing is done if it is at HEAD already. repoPath is the repository worktree or its '.git' dir.
+func Promote(ctx context.Context, repoPath string, to TagOptions, dryRun bool, opts Options) (res TagResult, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	opts = opts.withDefaults()
+	repo, err := openRepo(gitDir(repoPath), opts.CacheMB)
+	if err != nil {
+		return
+	}
+	r := newResolver(repo, opts)
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	tags, err := r.findTags(ctx)
+	if err != nil {
+		return res, fmt.Errorf("find tags: %w", err)
+	}
+	var final Version
+	for _, tag := range tags { // highest precedence first
+		if v, err := r.tagVersion(tag); err == nil && v.Prerelease != `` {
+			res.Previous, final = tag, v
+			break
+		}
+	}
+	if res.Previous == `` && len(tags) > 0 {
+		return res, fmt.Errorf("%w: tags %s are releases", ErrNoPrerelease, strings.Join(tags, `, `))
+	} else if res.Previous == `` {
+		return res, ErrNoPrerelease
+	}
+	final.Prerelease, final.Metadata = ``, ``
+	res.Tag = r.prefix + final.String()
+	if commit, err := r.tagCommit(res.Tag); err == nil {
+		if commit != h.Hash() {
+			return res, fmt.Errorf("%w: %s at commit %s", ErrTagExists, res.Tag, commit)
+		}
+		res.Reason = `already promoted`
+		return res, nil
+	}
+	if dryRun {
+		return
+	}
+	return r.tagHead(ctx, res, to.Remote, signature(repo, opts))
+}
+
+// autoTag create the next version tag of HEAD in repository without pushing it, ref is the created tag name in refs/tags/
+func autoTag(ctx context.Context, repo *git.Repository, to TagOptions, opts Options) (r *resolver, ref string, res TagResult, err error) {
+	f := newFields(ctx, repo, opts)
+	r = f.r
+	branch, err := f.headBranch()
+	if err != nil {
+		return r, ``, res, fmt.Errorf("get head branch: %w", err)
+	}
+	patterns := to.Branches
+	if len(patterns) == 0 {
+		patterns = DefaultTagBranches
+	}
+	if !slices.ContainsFunc(patterns, func(pattern string) bool {
+		ok, _ := path.Match(pattern, branch)
+		return ok
+	}) {
+		return r, ``, res, fmt.Errorf("%w: %s, allowed: %s", ErrBranchRefused, branch, strings.Join(patterns, `, `))
+	}
+	if dirty, err := r.dirtyHash(false); err != nil {
+		return r, ``, res, fmt.Errorf("check worktree: %w", err)
+	} else if dirty != `` {
+		return r, ``, res, ErrDirtyWorktree
+	}
+	tags, err := r.findTags(ctx)
+	if err != nil {
+		return r, ``, res, fmt.Errorf("find tags: %w", err)
+	}
+	for _, tag := range tags {
+		if _, err := r.tagVersion(tag); err == nil {
+			res.Tag, res.Reason = tag, `already tagged`
+			return r, ``, res, nil
+		}
+	}
+	if res.Previous, err = r.nearliestTag(ctx); err != nil {
+		return r, ``, res, fmt.Errorf("find nearliest tag: %w", err)
+	}
+	base := Version{Prefix: `v`}
+	if res.Previous != `` {
+		if base, err = r.tagVersion(res.Previous); err != nil {
+			return r, ``, res, fmt.Errorf("nearliest tag: %w", err)
+		}
+	}
+	commits, err := r.sinceTag(ctx, res.Previous, opts.MaxDepth)
+	if err != nil {
+		return r, ``, res, fmt.Errorf("get commits since %s: %w", res.Previous, err)
+	}
+	if res.Commits = len(commits); res.Commits == 0 {
+		res.Tag, res.Reason = res.Previous, `no commits since last tag`
+		return r, ``, res, nil
+	}
+	level := BumpPatch
+	for _, hash := range commits {
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return r, ``, res, fmt.Errorf("get commit %s: %w", hash, r.missing(err))
+		}
+		level = max(level, conventionalLevel(commit.Message))
+	}
+	if level == BumpMajor && base.Major == 0 {
+		level = BumpMinor
+	}
+	res.Level = level.String()
+	next := base.Bump(level)
+	res.Tag = opts.TagPrefix + next.String()
+	h, err := r.headRef()
+	if err != nil {
+		return
+	}
+	if ref, err = r.createTag(res.Tag, h.Hash(), `Release `+next.String(), signature(repo, opts)); err != nil {
+		return
+	}
+	res.Created = true
+	return
+}
+
+// DiscoveryOptions options to find '.git' dir of repository
+type DiscoveryOptions struct {
+	Depth   int      // levels of sub dirs searched below the dir and each of its parents, 0 means none
+	Exclude []string // patterns of sub dir names to skip, in filepath.Match syntax, hidden dirs are always skipped
+}
+
+// Validate check the discovery options
+func (o DiscoveryOptions) Validate() error {
+	if o.Depth < 0 {
+		return fmt.Errorf("invalid discovery depth %d, must not be negative", o.Depth)
+	}
+	for _, pattern := range o.Exclude {
+		if _, err := filepath.Match(pattern, ``); err != nil {
+			return fmt.Errorf("invalid exclude pattern %s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// FindGitRoot find '.git' dir from dir or its parent dirs, search one level of sub dirs
+func FindGitRoot(dir string) (gitRoot string, err error) {
+	return DiscoverGitRoot(dir, DiscoveryOptions{Depth: 1})
+}
+
+// DiscoverGitRoot find '.git' dir from dir or its parent dirs, search sub dirs down to opts.Depth levels
+func DiscoverGitRoot(dir string, opts DiscoveryOptions) (gitRoot string, err error) {
+	return DiscoverGitRootContext(context.Background(), dir, opts)
+}
+
+// DiscoverGitRootContext same as DiscoverGitRoot, stop searching sub dirs when ctx is done
+func DiscoverGitRootContext(ctx context.Context, dir string, opts DiscoveryOptions) (gitRoot string, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		err = fmt.Errorf("get absolute path: %w", err)
+		return
+	}
+	dir = cleanPath(dir)
+	for range [3]struct{}{} { // find '.git' dir from './' or '../' or '../../'
+		if gitRoot = findGitDir(ctx, dir, opts); gitRoot != `` {
+			return
+		}
+		if ctx.Err() != nil {
+			return ``, fmt.Errorf("search .git dir in %s: %w", dir, ctx.Err())
+		}
+		dir = filepath.Dir(dir)
+	}
+	return ``, fmt.Errorf("can not find .git dir for repo %s: %w", dir, os.ErrNotExist)
+}
+
+// findGitDir find '.git' dir in root and its sub dirs down to opts.Depth levels, symlinks and junctions to dir are followed,
+// entries which can not be read are skipped, the search ends without result when ctx is done
+func findGitDir(ctx context.Context, root string, opts DiscoveryOptions) (gitRoot string) {
+	_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			// '.git' may be a symlink or, on Windows, a junction to the git dir, which is not walked into
+			if isGitName(d.Name()) && d.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+				if info, err := os.Stat(path); err == nil && info.IsDir() {
+					gitRoot = path
+					return filepath.SkipAll
+				}
+			}
+			return nil
+		}
+		name := d.Name()
+		if isGitName(name) {
+			gitRoot = path
+			return filepath.SkipAll
+		}
+		if path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if strings.Count(rel, string(filepath.Separator)) >= opts.Depth || strings.HasPrefix(name, `.`) ||
+			slices.ContainsFunc(opts.Exclude, func(pattern string) bool {
+				ok, _ := filepath.Match(pattern, name)
+				return ok
+			}) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return
+}
+
+// gitDir get '.git' dir of repository path
+func gitDir(repoPath string) string {
+	repoPath = cleanPath(repoPath)
+	if !isGitName(filepath.Base(repoPath)) {
+		return filepath.Join(repoPath, `.git`)
+	}
+	return repoPath
+}
+
+// WorktreeDir get worktree dir of repository path which is the worktree or its '.git' dir
+func WorktreeDir(repoPath string) string {
+	repoPath = cleanPath(repoPath)
+	if isGitName(filepath.Base(repoPath)) {
+		return filepath.Dir(repoPath)
+	}
+	return repoPath
+}
+
+// isGitName report whether name is '.git', case-insensitively on Windows
+func isGitName(name string) bool {
+	if runtime.GOOS == `windows` {
+		return strings.EqualFold(name, `.git`)
+	}
+	return name == `.git`
+}
+
+// cleanPath clean path and resolve it to absolute path, so its base name is never '.' or '..',
+// and upper case its drive letter on Windows, e.g. 'c:\repo\' to 'C:\repo', UNC paths are kept as is,
+// the path is only cleaned if the current dir is unknown
+func cleanPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	} else {
+		p = filepath.Clean(p)
+	}
+	if vol := filepath.VolumeName(p); runtime.GOOS == `windows` && len(vol) == 2 && vol[1] == ':' {
+		p = strings.ToUpper(vol) + p[2:]
+	}
+	return p
+}
+
+// fields compute Info fields on demand, each output pulls only the fields it shows,
+// the expensive lookups behind them are memoized by resolver
+type fields struct {
+	ctx  context.Context
+	r    *resolver
+	opts Options
+
+	branch     string // memoized result of headBranch
+	branchErr  error
+	branchDone bool
+}
+
+// newFields create fields of repository HEAD, opts must have defaults filled
+func newFields(ctx context.Context, repo *git.Repository, opts Options) *fields {
+	opts.Logger = opts.Logger.With(`ref`, cmp.Or(opts.Ref, opts.Commit, `HEAD`))
+	return &fields{ctx: ctx, r: newResolver(repo, opts), opts: opts}
+}
+
+// exact get the tag at HEAD, or with Options.Paths the nearliest tag if no commit modified the paths since it,
+// since HEAD is the same as the tag for the paths
+func (f *fields) exact() (tag string, err error) {
+	tag, err = f.r.findTag(f.ctx)
+	if err != nil || tag != `` || len(f.opts.Paths) == 0 {
+		return
+	}
+	nearest, err := f.r.nearliestTag(f.ctx)
+	if errors.Is(err, ErrPartialClone) || errors.Is(err, ErrLimitExceeded) {
+		return ``, err
+	}
+	if err != nil || nearest == `` {
+		return ``, f.ctx.Err()
+	}
+	distance, err := f.r.tagDistance(f.ctx, nearest, f.opts.MaxDepth)
+	if err != nil {
+		f.opts.Logger.Warn("check paths modified since tag", `path`, f.opts.Paths, `tag`, nearest, `err`, err)
+		return ``, f.ctx.Err()
+	}
+	if distance == 0 {
+		return nearest, nil
+	}
+	return ``, nil
+}
+
+// tag get the tag at HEAD or the nearliest tag
+func (f *fields) tag() (tag string, err error) {
+	tag, err = f.exact()
+	if err != nil || tag != `` {
+		return
+	}
+	return f.r.nearliestTag(f.ctx)
+}
+
+// tagger get tagger and formatted date of the tag at HEAD or the nearliest tag, empty if no tag found
+func (f *fields) tagger() (tagger, date string, err error) {
+	tag, err := f.tag()
+	if err != nil || tag == `` {
+		return
+	}
+	tagger, when, err := f.r.tagger(tag)
+	if err != nil {
+		return
+	}
+	return tagger, commitDate(inZone(when, f.opts.TimeZone), f.opts.DateFormat), nil
+}
+
+// subject get subject of HEAD commit cut to Options.SubjectLength
+func (f *fields) subject() (string, error) {
+	commitID, err := f.r.headCommit()
+	if err != nil {
+		return ``, err
+	}
+	message, err := f.r.commitMessage(commitID)
+	if err != nil {
+		return ``, err
+	}
+	return Subject(message, f.opts.SubjectLength), nil
+}
+
+// sinceRelease get humanized duration from the date of the tag at HEAD or the nearliest tag to HEAD commit time,
+// empty if no tag found
+func (f *fields) sinceRelease() (string, error) {
+	tag, err := f.tag()
+	if err != nil || tag == `` {
+		return ``, err
+	}
+	_, tagged, err := f.r.tagger(tag)
+	if err != nil {
+		return ``, err
+	}
+	when, err := f.when(false)
+	if err != nil {
+		return ``, err
+	}
+	return humanDuration(when.Sub(tagged)), nil
+}
+
+// repoName get repository slug and normalized URL of origin, or name of worktree dir if there is no origin
+func (f *fields) repoName() (slug, u string, err error) {
+	remote, err := f.r.repo.Remote(`origin`)
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		if wt, err := f.r.repo.Worktree(); err == nil {
+			return filepath.Base(wt.Filesystem.Root()), ``, nil
+		}
+		return ``, ``, nil
+	}
+	if err != nil {
+		return ``, ``, fmt.Errorf("get remote origin: %w", err)
+	}
+	u = NormalizeURL(remote.Config().URLs[0])
+	return RepoSlug(u), u, nil
+}
+
+// tags get all tags at HEAD
+func (f *fields) tags() ([]string, error) {
+	return f.r.findTags(f.ctx)
+}
+
+// headBranch get branch of HEAD commit
+func (f *fields) headBranch() (string, error) {
+	if !f.branchDone {
+		var commitID string
+		commitID, f.branchErr = f.r.headCommit()
+		if f.branchErr == nil {
+			f.branch, f.branchErr = f.r.headBranch(f.ctx, commitID)
+		}
+		f.branchDone = true
+	}
+	return f.branch, f.branchErr
+}
+
+// commitTime get formatted commit time from Options.DateKind, or author time
+func (f *fields) commitTime(author bool) (string, error) {
+	when, err := f.when(author)
+	if err != nil {
+		return ``, err
+	}
+	return commitDate(when, f.opts.DateFormat), nil
+}
+
+// when get commit time from Options.DateKind, or author time
+func (f *fields) when(author bool) (when time.Time, err error) {
+	commitID, err := f.r.headCommit()
+	if err != nil {
+		return
+	}
+	committer, authored, err := f.r.commitTimes(commitID, f.opts.TimeZone)
+	if err != nil {
+		return
+	}
+	if author || f.opts.DateKind == `author` {
+		return authored, nil
+	}
+	return committer, nil
+}
+
+// version get the tag at HEAD or the pseudo-version built from the nearliest tag,
+// the pseudo-version is decorated with '-dev.<branch>' if HEAD is not on Options.ReleaseBranches,
+// or the output of git describe with Options.Compat describe
+func (f *fields) version() (version string, err error) {
+	if f.opts.Compat == `describe` {
+		return f.describe(false)
+	}
+	if version, err = f.note(); err != nil {
+		return
+	} else if version != `` {
+		return f.withMetadata(version), nil
+	}
+	if version, err = f.baseVersion(); err != nil {
+		return
+	}
+	if f.opts.ChannelInVersion {
+		if version, err = f.withChannel(version); err != nil {
+			return
+		}
+	}
+	if f.opts.DirtyHash && f.opts.Ref == `` && f.opts.Commit == `` {
+		var dirty string
+		if dirty, err = f.r.dirtyHash(f.opts.DirtyUntracked); err != nil {
+			return
+		}
+		if dirty != `` {
+			version += `-dirty.` + dirty
+		}
+	}
+	return f.withMetadata(version), nil
+}
+
+// withMetadata append build metadata to semantic version, after its own metadata if any,
+// versions which are not semantic versions are kept as is, e.g. branch name
+func (f *fields) withMetadata(version string) string {
+	metadata := f.opts.BuildMetadata
+	v, err := ParseVersion(version)
+	if metadata == `` || err != nil || f.opts.Module { // Go module versions have no build metadata
+		return version
+	}
+	if v.Metadata != `` {
+		return version + `.` + metadata
+	}
+	return version + `+` + metadata
+}
+
+// withChannel append release channel to prerelease of version
+func (f *fields) withChannel(version string) (string, error) {
+	channel, err := f.channel()
+	if err != nil || channel == `` {
+		return version, err
+	}
+	v, err := ParseVersion(version)
+	if err != nil {
+		return version, nil // e.g. branch name instead of semantic version with Options.ShowBranch
+	}
+	if v.Prerelease == `` {
+		v.Prerelease = channel
+	} else {
+		v.Prerelease += `.` + channel
+	}
+	return v.String(), nil
+}
+
+// baseVersion get version from the tag at HEAD, Maven snapshot or pseudo-version
+func (f *fields) baseVersion() (version string, err error) {
+	version, err = f.exact()
+	if err != nil {
+		return
+	}
+	version, _ = cutTagPrefix(version, f.opts.TagPrefix)
+	if f.opts.Snapshot {
+		return f.snapshot(version)
+	}
+	if version != `` {
+		return
+	}
+	version, err = f.pseudo()
+	if err != nil || len(f.opts.ReleaseBranches) == 0 {
+		return
+	}
+	release, err := f.releaseBranch()
+	if err != nil || release {
+		return
+	}
+	version += `-dev`
+	if branch, _ := f.headBranch(); branch != `` {
+		version += `.` + branchIdentifier(Sanitize(branch, f.opts.BranchLength))
+	}
+	return
+}
+
+// note get version override from note of HEAD in Options.NotesRef, empty if there is no note,
+// a note which does not parse as a version is ignored with a warning
+func (f *fields) note() (string, error) {
+	note, err := f.r.note(f.opts.NotesRef)
+	if err != nil {
+		return ``, fmt.Errorf("get note of %s: %w", f.opts.NotesRef, err)
+	}
+	if note = strings.TrimSpace(note); note == `` {
+		return ``, nil
+	}
+	if _, err = ParseVersion(note); err != nil {
+		f.opts.Logger.Warn("ignore note which is not a version", `ref`, f.opts.NotesRef, `err`, err)
+		return ``, nil
+	}
+	return note, nil
+}
+
+// versionFile get base version from Options.VersionFile in HEAD commit with 'v' prefix, e.g. 'v1.2.3',
+// empty if the option is not set, surrounding spaces and optional 'v' prefix in the file are tolerated
+func (f *fields) versionFile() (string, error) {
+	if f.opts.VersionFile == `` {
+		return ``, nil
+	}
+	h, err := f.r.headRef()
+	if err != nil {
+		return ``, err
+	}
+	commit, err := f.r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return ``, fmt.Errorf("get head commit: %w", err)
+	}
+	file, err := f.r.file(commit, f.opts.VersionFile)
+	if err != nil {
+		return ``, fmt.Errorf("get version file %s: %w", f.opts.VersionFile, f.r.missing(err))
+	}
+	data, err := file.Contents()
+	if err != nil {
+		return ``, fmt.Errorf("read version file %s: %w", f.opts.VersionFile, f.r.missing(err))
+	}
+	content := strings.TrimSpace(data)
+	v, err := ParseVersion(content)
+	if err != nil || v.Prefix != `` && v.Prefix != `v` {
+		return ``, fmt.Errorf("%w: version file %s: %q", ErrInvalidVersion, f.opts.VersionFile, content)
+	}
+	v.Prefix = `v`
+	return v.String(), nil
+}
+
+// checkModule check major version of version matches the major version suffix of module path
+// in go.mod at each of Options.Paths, or at repository root without paths, e.g. tag v2.0.0 requires module path '.../v2',
+// missing go.mod and versions which are not semantic versions are skipped
+func (f *fields) checkModule(version string) error {
+	v, err := ParseVersion(version)
+	if err != nil || v.Metadata == `incompatible` {
+		return nil
+	}
+	modPaths, err := f.modulePaths()
+	if err != nil {
+		return err
+	}
+	for _, modPath := range modPaths {
+		_, pathMajor, ok := module.SplitPathVersion(modPath)
+		if !ok {
+			continue
+		}
+		major, _ := strconv.Atoi(strings.TrimLeft(pathMajor, `/.v`))
+		switch {
+		case pathMajor == `` && v.Major >= 2:
+			return fmt.Errorf("%w: version %s requires module path %s/v%d, got %s", ErrModuleMismatch, version, modPath, v.Major, modPath)
+		case pathMajor != `` && v.Major != major:
+			return fmt.Errorf("%w: version %s does not match major version %s of module path %s", ErrModuleMismatch, version, pathMajor, modPath)
+		}
+	}
+	return nil
+}
+
+// modulePaths get module paths of go.mod files at HEAD in Options.Paths, or in the root without Paths,
+// dirs without go.mod are skipped
+func (f *fields) modulePaths() (modPaths []string, err error) {
+	h, err := f.r.headRef()
+	if err != nil {
+		return
+	}
+	commit, err := f.r.repo.CommitObject(h.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("get head commit: %w", err)
+	}
+	dirs := f.opts.Paths
+	if len(dirs) == 0 {
+		dirs = []string{``}
+	}
+	for _, dir := range dirs {
+		file, err := f.r.file(commit, path.Join(dir, `go.mod`))
+		if errors.Is(err, object.ErrFileNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get go.mod in %s: %w", dir, f.r.missing(err))
+		}
+		data, err := file.Contents()
+		if err != nil {
+			return nil, fmt.Errorf("read go.mod in %s: %w", dir, f.r.missing(err))
+		}
+		if modPath := modfile.ModulePath([]byte(data)); modPath != `` {
+			modPaths = append(modPaths, modPath)
+		}
+	}
+	return
+}
+
+// snapshot get Maven version, the exact tag at HEAD without prefix, or the base version bumped from the nearliest tag
+// with '-SNAPSHOT', or with unique snapshot timestamp and commits count since the tag, e.g. '1.5.0-20240607.123455-3'
+func (f *fields) snapshot(exact string) (string, error) {
+	if exact != `` {
+		if v, err := parseTag(exact, f.opts.LooseVersions); err == nil {
+			v.Prefix = ``
+			return v.String(), nil
+		}
+		return exact, nil
+	}
+	tag, err := f.r.nearliestTag(f.ctx)
+	if e := stopped(f.ctx, err); e != nil {
+		return ``, fmt.Errorf("find nearliest tag: %w", e)
+	}
+	if errors.Is(err, ErrPartialClone) {
+		return ``, err
+	}
+	if err != nil {
+		tag = ``
+	}
+	ref, _ := cutTagPrefix(tag, f.opts.TagPrefix)
+	if ref == `` {
+		if ref, err = f.versionFile(); err != nil {
+			return ``, err
+		}
+	}
+	var base Version
+	if v, err := parseTag(ref, f.opts.LooseVersions); err == nil {
+		base = v.Bump(BumpPatch)
+		base.Prefix = ``
+	}
+	if !f.opts.SnapshotUnique {
+		base.Prerelease = `SNAPSHOT`
+		return base.String(), nil
+	}
+	when, err := f.when(false)
+	if err != nil {
+		return ``, err
+	}
+	distance, err := f.r.tagDistance(f.ctx, tag, f.opts.MaxDepth)
+	if err != nil {
+		return ``, fmt.Errorf("get distance from tag '%s': %w", tag, err)
+	}
+	base.Prerelease = when.UTC().Format(`20060102.150405`) + `-` + strconv.Itoa(distance)
+	return base.String(), nil
+}
+
+// releaseBranch check whether the branch of HEAD matches any of Options.ReleaseBranches,
+// HEAD without branch is not on release branch
+func (f *fields) releaseBranch() (bool, error) {
+	branch, err := f.headBranch()
+	if errors.Is(err, ErrNoBranchFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(f.opts.ReleaseBranches, func(pattern string) bool {
+		ok, _ := path.Match(pattern, branch)
+		return ok
+	}), nil
+}
+
+// channel get release channel of the first rule in Options.Channels matching the tag at HEAD ('@tag')
+// or the branch of HEAD, empty if no rule matches
+func (f *fields) channel() (string, error) {
+	rules := f.opts.Channels
+	if len(rules) == 0 {
+		rules = DefaultChannels
+	}
+	var tag, branch string
+	var tagDone, branchDone bool
+	for _, rule := range rules {
+		name, pattern, _ := strings.Cut(rule, `=`)
+		switch pattern {
+		case `*`:
+			return name, nil
+		case `@tag`:
+			if !tagDone {
+				t, err := f.exact()
+				if err != nil {
+					return ``, err
+				}
+				tag, tagDone = t, true
+			}
+			if tag != `` {
+				return name, nil
+			}
+		default:
+			if !branchDone {
+				b, err := f.headBranch()
+				if err != nil && !errors.Is(err, ErrNoBranchFound) {
+					return ``, err
+				}
+				branch, branchDone = b, true
+			}
+			if ok, _ := path.Match(pattern, branch); ok && branch != `` {
+				return name, nil
+			}
+		}
+	}
+	return ``, nil
+}
+
+// releaseBranchValue get ReleaseBranch field, empty if Options.ReleaseBranches are not set
+func (f *fields) releaseBranchValue() (string, error) {
+	if len(f.opts.ReleaseBranches) == 0 {
+		return ``, nil
+	}
+	release, err := f.releaseBranch()
+	if err != nil {
+		return ``, err
+	}
+	return strconv.FormatBool(release), nil
+}
+
+// pseudo get the pseudo-version built from the nearliest tag,
+// the branch is only resolved if the pseudo-version uses it
+func (f *fields) pseudo() (version string, err error) {
+	commitID, err := f.r.headCommit()
+	if f.opts.ContentHash && err == nil {
+		commitID, err = f.r.treeHash()
+	}
+	if err != nil {
+		return
+	}
+	when, err := f.when(false)
+	if err != nil {
+		return
+	}
+	tag, err := f.r.nearliestTag(f.ctx)
+	if e := stopped(f.ctx, err); e != nil {
+		return ``, fmt.Errorf("find nearliest tag: %w", e)
+	}
+	if errors.Is(err, ErrPartialClone) {
+		return ``, err
+	}
+	if err != nil {
+		tag = ``
+	}
+	if _, err = f.r.tagVersion(tag); tag != `` && err != nil {
+		f.opts.Logger.Warn("ignore nearliest tag in pseudo-version, use -semver-only to find an older version tag", `tag`, tag, `err`, err)
+		tag = ``
+	}
+	var branch string
+	if !f.opts.Module && (tag == `` && f.opts.ShowBranch || f.opts.BranchInVersion ||
+		strings.Contains(f.opts.PseudoFormat, `{branch}`)) {
+		branch, err = f.headBranch()
+		if errors.Is(err, ErrNoBranchFound) {
+			err = nil
+		} else if err != nil {
+			return
+		}
+	}
+	if branch != `` {
+		branch = Sanitize(branch, f.opts.BranchLength)
+	}
+	ref, _ := cutTagPrefix(tag, f.opts.TagPrefix)
+	if ref == `` {
+		if ref, err = f.versionFile(); err != nil {
+			return
+		}
+	}
+	if f.opts.BranchInVersion {
+		return branchPseudo(ref, branch, commitID, when, cmp.Or(f.opts.Abbrev, DefaultAbbrev), f.opts.LooseVersions)
+	}
+	if f.opts.Module {
+		var modPaths []string
+		if modPaths, err = f.modulePaths(); err != nil {
+			return
+		}
+		modPath := ``
+		if len(modPaths) > 0 {
+			modPath = modPaths[0]
+		}
+		return modulePseudo(modPath, ref, commitID, when), nil
+	}
+	if ref == `` {
+		if f.opts.ShowBranch {
+			ref = branch
+		} else {
+			ref = `v0.0.0`
+		}
+	}
+	return formatPseudo(f.ctx, f.r, ref, tag, branch, commitID, when, f.opts)
+}
+
+// describe get description of HEAD like 'git describe --tags --dirty' with '--long', empty if no tag is reachable,
+// or with '--always' instead, which is the tag alone at HEAD, or the abbreviated hash if no tag is reachable
+func (f *fields) describe(long bool) (description string, err error) {
+	tag, depth, err := f.r.describe(f.ctx)
+	if err != nil || tag == `` && long {
+		return
+	}
+	h, err := f.r.headRef()
+	if err != nil {
+		return
+	}
+	abbrev, err := f.r.abbrevHash(h.Hash(), f.opts.Abbrev)
+	switch {
+	case err != nil:
+		return
+	case tag == ``:
+		description = abbrev
+	case depth == 0 && !long:
+		description = tag
+	default:
+		description = fmt.Sprintf("%s-%d-g%s", tag, depth, abbrev)
+	}
+	if f.opts.Ref != `` || f.opts.Commit != `` {
+		return
+	}
+	dirty, err := f.r.dirtyHash(false)
+	if dirty != `` {
+		description += `-dirty`
+	}
+	return
+}
+
+// buildNumber count commits reachable from HEAD, or since the tag in since-tag mode, or the explicit number
+func (f *fields) buildNumber() (string, error) {
+	if strings.Trim(f.opts.BuildNumber, `0123456789`) == `` {
+		return f.opts.BuildNumber, nil // explicit number
+	}
+	var tag string
+	if f.opts.BuildNumber == `since-tag` {
+		var err error
+		if tag, err = f.tag(); err != nil {
+			return ``, fmt.Errorf("find nearliest tag: %w", err)
+		}
+	}
+	count, err := f.r.tagDistance(f.ctx, tag, f.opts.MaxDepth)
+	if err != nil {
+		return ``, err
+	}
+	return strconv.Itoa(count), nil
+}
+
+// firstCommit get count of commits reachable from HEAD, formatted time of the oldest root commit and the age since it,
+// the walk is limited by Options.MaxDepth
+func (f *fields) firstCommit() (commits, first, age string, err error) {
+	count, when, err := f.r.firstCommit(f.ctx, f.opts.MaxDepth)
+	if err != nil {
+		return
+	}
+	now := cmp.Or(f.opts.SourceDate, time.Now())
+	return strconv.Itoa(count), commitDate(inZone(when, f.opts.TimeZone), f.opts.DateFormat), now.Sub(when).Round(time.Second).String(), nil
+}
+
+// contributors get authors of commits since the tag at HEAD or the nearliest tag, all commits if no tag found
+func (f *fields) contributors() ([]Contributor, error) {
+	tag, err := f.tag()
+	if err != nil {
+		return nil, fmt.Errorf("find nearliest tag: %w", err)
+	}
+	return f.r.contributors(f.ctx, tag, f.opts.MaxDepth)
+}
+
+// diffStat get changes between trees of the nearliest tag and HEAD
+func (f *fields) diffStat() (*DiffStat, error) {
+	tag, err := f.tag()
+	if err != nil {
+		return nil, fmt.Errorf("find nearliest tag: %w", err)
+	}
+	stat, err := f.r.diffStat(f.ctx, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
+
+// submodules get submodules in .gitmodules of worktree with the pinned and checked-out commits,
+// the version of each initialized submodule is resolved in its repository with options of the superproject,
+// except those choosing the commit, paths or tags of the superproject. Failure of one submodule is kept in its Error
+func (f *fields) submodules() (list []Submodule, err error) {
+	w, err := f.r.repo.Worktree()
+	if errors.Is(err, git.ErrIsBareRepository) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("get worktree: %w", err)
+	}
+	modules, err := w.Submodules()
+	if err != nil {
+		return nil, fmt.Errorf("read .gitmodules: %w", err)
+	}
+	idx, err := f.r.repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+	opts := f.opts
+	opts.Submodules, opts.Ref, opts.Commit, opts.CIBranch, opts.CITag, opts.CICommit = false, ``, ``, ``, ``, ``
+	opts.TagPrefix, opts.TagNamespaces, opts.Paths, opts.Ignore, opts.VersionFile = ``, nil, nil, nil, ``
+	for _, m := range modules {
+		if err = f.ctx.Err(); err != nil {
+			return
+		}
+		c := m.Config()
+		s := Submodule{Path: c.Path, Status: `uninitialized`}
+		if e, err := idx.Entry(c.Path); err == nil && e.Mode == filemode.Submodule {
+			s.Commit = e.Hash.String()
+		}
+		// go-git initializes an empty module storage for a submodule not cloned yet, only open existing ones
+		var repo *git.Repository
+		if st, err := f.r.repo.Storer.Module(c.Name); err == nil {
+			if _, err = st.Reference(plumbing.HEAD); err == nil {
+				repo, err = m.Repository()
+			}
+			if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) && !errors.Is(err, git.ErrSubmoduleNotInitialized) {
+				s.Error = err.Error()
+			}
+		}
+		if repo != nil {
+			if head, err := repo.Head(); err == nil {
+				s.Current = head.Hash().String()
+			}
+		}
+		switch {
+		case s.Commit == ``:
+			s.Status = `missing`
+		case s.Current == ``:
+		case s.Current == s.Commit:
+			s.Status = `ok`
+		default:
+			s.Status = `modified`
+		}
+		if s.Current != `` {
+			var err error
+			if s.Version, err = FieldRepository(f.ctx, repo, `Version`, opts); err != nil {
+				s.Error = err.Error()
+				f.opts.Logger.Warn("get version of submodule", `path`, c.Path, `err`, err)
+			}
+		}
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b Submodule) int { return strings.Compare(a.Path, b.Path) })
+	return list, nil
+}
+
+// formatPseudo build pseudo-version by replacing placeholders in Options.PseudoFormat
+func formatPseudo(ctx context.Context, r *resolver, ref, tag, branch, commitID string, when time.Time, opts Options) (string, error) {
+	pairs := []string{
+		`{ref}`, ref,
+		`{date}`, commitDate(when, `compact`),
+		`{hash}`, commitID[:cmp.Or(opts.Abbrev, DefaultAbbrev)],
+		`{branch}`, branch,
+	}
+	if strings.Contains(opts.PseudoFormat, `{distance}`) {
+		distance, err := r.tagDistance(ctx, tag, opts.MaxDepth)
+		if err != nil {
+			return ``, fmt.Errorf("get distance from tag '%s': %w", tag, err)
+		}
+		pairs = append(pairs, `{distance}`, strconv.Itoa(distance))
+	}
+	return strings.NewReplacer(pairs...).Replace(opts.PseudoFormat), nil
+}
+
+// branchPseudo build pseudo-version with branch identifier as prerelease segment after the base version
+// bumped from tag, or 'v0.0.0' if tag is not a semantic version, e.g. 'v1.5.0-featurefoo.20240607123455-abcdef123456'
+func branchPseudo(tag, branch, commitID string, when time.Time, abbrev int, loose bool) (string, error) {
+	base := Version{Prefix: `v`}
+	if v, err := parseTag(tag, loose); err == nil {
+		base = v.Bump(BumpPatch)
+	}
+	base.Prerelease = commitDate(when, `compact`) + `-` + commitID[:abbrev]
+	if id := branchIdentifier(branch); id != `` {
+		base.Prerelease = id + `.` + base.Prerelease
+	}
+	version := base.String()
+	if _, err := ParseVersion(version); err != nil {
+		return ``, fmt.Errorf("branch pseudo-version: %w", err)
+	}
+	return version, nil
+}
+
+// branchIdentifier get semantic version prerelease identifier of sanitized branch
+func branchIdentifier(branch string) string {
+	if len(branch) > 1 && branch[0] == '0' && strings.Trim(branch, `0123456789`) == `` {
+		return `b` + branch // numeric identifier must not have leading zero
+	}
+	return branch
+}
+
+// Subject get first line of commit message with control characters removed, e.g. escape sequences,
+// the result is cut to maxLen characters if it is greater than 0, multi-byte characters are never split
+func Subject(message string, maxLen int) string {
+	line, _, _ := strings.Cut(strings.TrimLeft(message, "\r\n"), "\n")
+	line = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(line, "\uFFFD")))
+	if runes := []rune(line); maxLen > 0 && len(runes) > maxLen {
+		line = string(runes[:maxLen])
+	}
+	return line
+}
+
+// Sanitize convert s to lower case identifier valid in semantic version prerelease and Docker tag,
+// characters other than letters and digits are replaced with '-' and repeats are collapsed,
+// e.g. 'feature/JIRA-123_fix#2' to 'feature-jira-123-fix-2', the result is cut to maxLen if it is greater than 0.
+// The result is never empty, it falls back to a short hash of s.
+func Sanitize(s string, maxLen int) string {
+	id := strings.Trim(sanitizeReg.ReplaceAllString(strings.ToLower(s), `-`), `-`)
+	if maxLen > 0 && len(id) > maxLen {
+		id = strings.TrimRight(id[:maxLen], `-`)
+	}
+	if id == `` {
+		sum := sha256.Sum256([]byte(s))
+		id = hex.EncodeToString(sum[:])[:8]
+	}
+	return id
+}
+
+// DockerTag convert version to valid Docker/OCI image tag: characters other than letters, digits, '_', '.' and '-'
+// are replaced with '-' and repeats are collapsed, leading '.' and '-' are removed,
+// e.g. 'v1.5.0-feature/login.20240607-abcd' to 'v1.5.0-feature-login.20240607-abcd'.
+// A tag longer than 128 characters is cut before its last '-' segment to keep the commit hash suffix.
+func DockerTag(version string) string {
+	tag := strings.TrimLeft(dockerTagReg.ReplaceAllString(version, `-`), `.-`)
+	if tag == `` {
+		return Sanitize(version, 0)
+	}
+	if len(tag) <= maxDockerTag {
+		return tag
+	}
+	i := strings.LastIndexByte(tag, '-')
+	suffix := tag[i+1:]
+	if i < 0 || len(suffix) > maxDockerTag/2 {
+		return tag[:maxDockerTag]
+	}
+	return strings.TrimRight(tag[:maxDockerTag-len(suffix)-1], `.-`) + `-` + suffix
+}
+
+// modulePseudo build pseudo-version in the same format as Go module tooling, the major version comes from
+// the module path, e.g. 'v2' of 'example.com/m/v2', the tag is used as base version only if it is
+// a valid semantic version of that major version
+func modulePseudo(modPath, tag, commitID string, when time.Time) string {
+	major := `v0`
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	if pathMajor != `` {
+		major = module.PathMajorPrefix(pathMajor)
+	}
+	var older string
+	if semver.IsValid(tag) && module.CheckPathMajor(tag, pathMajor) == nil {
+		older = tag
+	}
+	return module.PseudoVersion(major, older, when, commitID[:12])
+}
+
+// inZone convert time to time zone: utc, local, or committer to keep it as is
+func inZone(t time.Time, tz string) time.Time {
+	switch tz {
+	case `utc`:
+		return t.UTC()
+	case `local`:
+		return t.Local()
+	}
+	return t
+}
+
+// humanDuration format d in its largest whole unit of days, hours or minutes, e.g. '37d', negative d is '0m'
+func humanDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return strconv.Itoa(int(d/(24*time.Hour))) + `d`
+	case d >= time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + `h`
+	}
+	return strconv.Itoa(int(max(d, 0)/time.Minute)) + `m`
+}
+
+// ParseDate parse time s formatted by commit time format of Options.DateFormat: a preset name or Go layout,
+// e.g. CommitTime of Info, times without zone are in UTC
+func ParseDate(s, format string) (time.Time, error) {
+	if format == `unix` {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		return time.Unix(sec, 0).UTC(), err
+	}
+	if l, ok := dateLayouts[format]; ok {
+		format = l
+	}
+	return time.Parse(format, s)
+}
+
+// commitDate format commit time with layout or preset name in dateLayouts
+func commitDate(when time.Time, layout string) string {
+	if layout == `unix` {
+		return strconv.FormatInt(when.Unix(), 10)
+	}
+	if l, ok := dateLayouts[layout]; ok {
+		layout = l
+	}
+	return when.Format(layout)
+}
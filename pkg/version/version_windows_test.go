@@ -0,0 +1,68 @@
+package version
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRepoPathWindows drive letters are upper cased, '.git' matches in any case, UNC paths are kept as is
+func TestRepoPathWindows(t *testing.T) {
+	for _, tt := range []struct {
+		path, clean, worktree, gitDir string
+	}{
+		{`c:\repo`, `C:\repo`, `C:\repo`, `C:\repo\.git`},
+		{`c:\repo\`, `C:\repo`, `C:\repo`, `C:\repo\.git`},
+		{`C:/repo/./sub/..`, `C:\repo`, `C:\repo`, `C:\repo\.git`},
+		{`c:\repo\.git`, `C:\repo\.git`, `C:\repo`, `C:\repo\.git`},
+		{`c:\repo\.GIT\`, `C:\repo\.GIT`, `C:\repo`, `C:\repo\.GIT`},
+		{`d:\Repo\.Git`, `D:\Repo\.Git`, `D:\Repo`, `D:\Repo\.Git`},
+		{`\\server\share\repo`, `\\server\share\repo`, `\\server\share\repo`, `\\server\share\repo\.git`},
+		{`\\server\share\repo\`, `\\server\share\repo`, `\\server\share\repo`, `\\server\share\repo\.git`},
+		{`\\server\share\repo\.GIT`, `\\server\share\repo\.GIT`, `\\server\share\repo`, `\\server\share\repo\.GIT`},
+		{`//server/share/repo/.git`, `\\server\share\repo\.git`, `\\server\share\repo`, `\\server\share\repo\.git`},
+		{`\\?\c:\repo`, `\\?\c:\repo`, `\\?\c:\repo`, `\\?\c:\repo\.git`},
+	} {
+		if got := cleanPath(tt.path); got != tt.clean {
+			t.Errorf("cleanPath(%q) = %q, want %q", tt.path, got, tt.clean)
+		}
+		if got := WorktreeDir(tt.path); got != tt.worktree {
+			t.Errorf("WorktreeDir(%q) = %q, want %q", tt.path, got, tt.worktree)
+		}
+		if got := gitDir(tt.path); got != tt.gitDir {
+			t.Errorf("gitDir(%q) = %q, want %q", tt.path, got, tt.gitDir)
+		}
+	}
+}
+
+// TestGitDirJunction '.git' which is an NTFS junction to the git dir elsewhere is found and opened,
+// also through a lower case drive letter
+func TestGitDirJunction(t *testing.T) {
+	f := newDiskFixture(t)
+	f.commit(`init`, map[string]string{`main.go`: "1\r\n"})
+	f.tag(`v1.0.0`)
+	f.checkout()
+	worktree := filepath.Join(t.TempDir(), `foo`)
+	if err := os.Mkdir(worktree, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(worktree, `.git`)
+	if out, err := exec.Command(`cmd`, `/c`, `mklink`, `/J`, link, filepath.Join(f.dir, `.git`)).CombinedOutput(); err != nil {
+		t.Skipf("create junction: %v: %s", err, out)
+	}
+	for _, dir := range []string{worktree, strings.ToLower(worktree[:1]) + worktree[1:], filepath.Dir(worktree)} {
+		gitRoot, err := DiscoverGitRoot(dir, DiscoveryOptions{Depth: 1})
+		if err != nil || !strings.EqualFold(gitRoot, link) {
+			t.Errorf("DiscoverGitRoot(%q) = %q, %v, want %q", dir, gitRoot, err, link)
+		}
+		if filepath.VolumeName(gitRoot) != strings.ToUpper(filepath.VolumeName(gitRoot)) {
+			t.Errorf("DiscoverGitRoot(%q) = %q, want upper case drive letter", dir, gitRoot)
+		}
+	}
+	if v, err := Field(context.Background(), link, `Version`, Options{}); err != nil || v != `v1.0.0` {
+		t.Errorf("version by junctioned git dir %q, %v, want v1.0.0", v, err)
+	}
+}
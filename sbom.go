@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/yougg/gv/pkg/version"
+)
+
+// sbomFormats supported SBOM fragment formats
+var sbomFormats = []string{`spdx`, `cyclonedx`}
+
+// spdxIDReg match characters invalid in SPDX identifier
+var spdxIDReg = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// writeSBOM write SBOM fragment in format of the component built from repository at gitRoot,
+// with its version, VCS URL of origin, commit and build time now
+func writeSBOM(w io.Writer, format, gitRoot string, info version.Info, now time.Time) error {
+	vcs, err := version.RemoteURL(gitRoot, `origin`)
+	if err != nil {
+		return fmt.Errorf("get origin URL: %w", err)
+	}
+	name := filepath.Base(version.WorktreeDir(gitRoot))
+	if vcs != `` {
+		name = path.Base(vcs)
+	}
+	built := now.UTC().Format(time.RFC3339)
+
+	var fragment any
+	switch format {
+	case `spdx`:
+		location := `NOASSERTION`
+		if vcs != `` {
+			location = `git+` + vcs + `@` + info.CommitID
+		}
+		fragment = map[string]any{
+			`packages`: []map[string]any{{
+				`SPDXID`:           `SPDXRef-Package-` + spdxIDReg.ReplaceAllString(name, `-`),
+				`name`:             name,
+				`versionInfo`:      info.Version,
+				`downloadLocation`: location,
+				`sourceInfo`:       `git commit ` + info.CommitID,
+				`builtDate`:        built,
+				`filesAnalyzed`:    false,
+			}},
+		}
+	case `cyclonedx`:
+		component := map[string]any{
+			`type`:     `application`,
+			`bom-ref`:  name + `@` + info.Version,
+			`name`:     name,
+			`version`:  info.Version,
+			`pedigree`: map[string]any{`commits`: []map[string]any{{`uid`: info.CommitID}}},
+		}
+		if vcs != `` {
+			component[`externalReferences`] = []map[string]any{{`type`: `vcs`, `url`: vcs}}
+		}
+		fragment = map[string]any{
+			`metadata`: map[string]any{`timestamp`: built, `component`: component},
+		}
+	default:
+		return fmt.Errorf("unknown SBOM format %s", format)
+	}
+	data, err := json.MarshalIndent(fragment, ``, `  `)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
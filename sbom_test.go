@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+// spdxFragment fragment of SPDX 2.3 document, fields of package from spdx-schema.json,
+// required ones are not omitted
+type spdxFragment struct {
+	Packages []struct {
+		SPDXID           string `json:"SPDXID"`
+		Name             string `json:"name"`
+		VersionInfo      string `json:"versionInfo,omitempty"`
+		DownloadLocation string `json:"downloadLocation"`
+		SourceInfo       string `json:"sourceInfo,omitempty"`
+		BuiltDate        string `json:"builtDate,omitempty"`
+		FilesAnalyzed    *bool  `json:"filesAnalyzed,omitempty"`
+	} `json:"packages"`
+}
+
+// cyclonedxFragment fragment of CycloneDX 1.5 BOM, fields of metadata and component from bom-1.5.schema.json,
+// which forbids additional properties
+type cyclonedxFragment struct {
+	Metadata struct {
+		Timestamp string `json:"timestamp"`
+		Component struct {
+			Type               string `json:"type"`
+			BOMRef             string `json:"bom-ref,omitempty"`
+			Name               string `json:"name"`
+			Version            string `json:"version,omitempty"`
+			ExternalReferences []struct {
+				Type string `json:"type"`
+				URL  string `json:"url"`
+			} `json:"externalReferences,omitempty"`
+			Pedigree struct {
+				Commits []struct {
+					UID string `json:"uid,omitempty"`
+				} `json:"commits,omitempty"`
+			} `json:"pedigree"`
+		} `json:"component"`
+	} `json:"metadata"`
+}
+
+var (
+	// spdxIDPattern pattern of SPDXID in the SPDX 2.3 spec
+	spdxIDPattern = regexp.MustCompile(`^SPDXRef-[a-zA-Z0-9.-]+$`)
+	// spdxLocationPattern NONE, NOASSERTION or VCS location '<vcs_tool>+<transport>://<host>/<path>@<revision>'
+	spdxLocationPattern = regexp.MustCompile(`^(NONE|NOASSERTION|git\+(https?|ssh|git)://[^@\s]+(@[0-9a-f]{40})?)$`)
+	// spdxDatePattern date format 'YYYY-MM-DDThh:mm:ssZ' of the SPDX 2.3 spec
+	spdxDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}Z$`)
+	// cyclonedxComponentTypes enum of component type in CycloneDX 1.5
+	cyclonedxComponentTypes = []string{`application`, `framework`, `library`, `container`, `platform`, `operating-system`,
+		`device`, `device-driver`, `firmware`, `file`, `machine-learning-model`, `data`}
+)
+
+// decodeStrict decode data into v, properties not in v are errors, also the ones differing only in case
+// which encoding/json matches, since the schemas are case-sensitive
+func decodeStrict(t *testing.T, data []byte, v any) {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	if dec.More() {
+		t.Fatalf("more than one JSON value: %s", data)
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want any
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal(encoded, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("properties differ from schema:\n%s\nwant:\n%s", data, encoded)
+	}
+}
+
+// TestSBOMSchema -sbom fragments have the required properties of the SPDX and CycloneDX schemas in their formats,
+// and no other properties
+func TestSBOMSchema(t *testing.T) {
+	const epoch, built = `1717763695`, `2024-06-07T12:34:55Z`
+	t.Setenv(`SOURCE_DATE_EPOCH`, epoch)
+	dir := testRepo(t, true)
+	commitID := runField(t, dir, `CommitID`)
+	version := runField(t, dir, `Version`)
+
+	for _, origin := range []string{``, `git@github.com:yougg/gv.git`} {
+		if origin != `` {
+			repo, err := git.PlainOpen(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = repo.CreateRemote(&config.RemoteConfig{Name: `origin`, URLs: []string{origin}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		code, out := runOutput(t, `-r`, dir, `-sbom`, `spdx`)
+		if code != 0 {
+			t.Fatalf("origin %q: -sbom spdx: exit code %d", origin, code)
+		}
+		var spdx spdxFragment
+		decodeStrict(t, []byte(out), &spdx)
+		if len(spdx.Packages) != 1 {
+			t.Fatalf("origin %q: spdx packages %d, want 1", origin, len(spdx.Packages))
+		}
+		p := spdx.Packages[0]
+		if !spdxIDPattern.MatchString(p.SPDXID) || p.Name == `` || p.VersionInfo != version {
+			t.Errorf("origin %q: spdx package id %q name %q version %q, want version %s", origin, p.SPDXID, p.Name, p.VersionInfo, version)
+		}
+		if !spdxLocationPattern.MatchString(p.DownloadLocation) || !spdxDatePattern.MatchString(p.BuiltDate) || p.FilesAnalyzed == nil {
+			t.Errorf("origin %q: spdx download location %q built date %q files analyzed %v", origin, p.DownloadLocation, p.BuiltDate, p.FilesAnalyzed)
+		}
+		if want := `git+https://github.com/yougg/gv@` + commitID; origin != `` && p.DownloadLocation != want {
+			t.Errorf("origin %q: spdx download location %q, want %q", origin, p.DownloadLocation, want)
+		}
+		if p.BuiltDate != built || p.SourceInfo != `git commit `+commitID {
+			t.Errorf("origin %q: spdx built date %q source %q, want %s and commit %s", origin, p.BuiltDate, p.SourceInfo, built, commitID)
+		}
+
+		code, out = runOutput(t, `-r`, dir, `-sbom`, `cyclonedx`)
+		if code != 0 {
+			t.Fatalf("origin %q: -sbom cyclonedx: exit code %d", origin, code)
+		}
+		var cdx cyclonedxFragment
+		decodeStrict(t, []byte(out), &cdx)
+		c := cdx.Metadata.Component
+		if _, err := time.Parse(time.RFC3339, cdx.Metadata.Timestamp); err != nil || cdx.Metadata.Timestamp != built {
+			t.Errorf("origin %q: cyclonedx timestamp %q, want %s: %v", origin, cdx.Metadata.Timestamp, built, err)
+		}
+		if !slices.Contains(cyclonedxComponentTypes, c.Type) || c.Name == `` || c.Version != version || c.BOMRef == `` {
+			t.Errorf("origin %q: cyclonedx component type %q name %q version %q ref %q, want version %s", origin, c.Type, c.Name, c.Version, c.BOMRef, version)
+		}
+		if len(c.Pedigree.Commits) != 1 || c.Pedigree.Commits[0].UID != commitID {
+			t.Errorf("origin %q: cyclonedx commits %v, want %s", origin, c.Pedigree.Commits, commitID)
+		}
+		wantRefs := 0
+		if origin != `` {
+			wantRefs = 1
+		}
+		if len(c.ExternalReferences) != wantRefs {
+			t.Fatalf("origin %q: cyclonedx external references %v, want %d", origin, c.ExternalReferences, wantRefs)
+		}
+		for _, ref := range c.ExternalReferences {
+			if ref.Type != `vcs` || ref.URL != `https://github.com/yougg/gv` {
+				t.Errorf("origin %q: cyclonedx external reference %s %s, want vcs https://github.com/yougg/gv", origin, ref.Type, ref.URL)
+			}
+		}
+	}
+}
+
+// runField run gv to get field, fail the test on error
+func runField(t *testing.T, dir, name string) string {
+	t.Helper()
+	code, out := runOutput(t, `-r`, dir, `-field`, name)
+	if code != 0 {
+		t.Fatalf("-field %s: exit code %d", name, code)
+	}
+	return strings.TrimSpace(out)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/yougg/gv/pkg/version"
+	"golang.org/x/mod/modfile"
+)
+
+// workspaceModule module used by go.work with its version
+type workspaceModule struct {
+	Path      string `json:"path"`      // module path in go.mod
+	Dir       string `json:"dir"`       // dir of 'use' directive in go.work
+	TagPrefix string `json:"tagPrefix"` // slash separated dir of module in its repository with '/', empty for module at repository root
+	Version   string `json:"version"`
+}
+
+// Workspace write module path, dir and version of each module used by go.work in dir, one per line,
+// or as JSON array with -json. Each module is resolved in its own repository with tags prefixed by its dir in the
+// repository, e.g. 'services/foo/v1.2.3', and only counts commits modifying the dir, like Go module tags
+func (o *options) Workspace(ctx context.Context, stdout, stderr io.Writer, dir string) error {
+	name := filepath.Join(dir, `go.work`)
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	work, err := modfile.ParseWork(name, data, nil)
+	if err != nil {
+		return err
+	}
+	modules := []workspaceModule{}
+	for _, use := range work.Use {
+		m, err := o.workspaceVersion(ctx, stderr, dir, use.Path)
+		if err != nil {
+			return fmt.Errorf("module %s: %w", use.Path, err)
+		}
+		modules = append(modules, m)
+	}
+	var buf bytes.Buffer
+	if o.jsonOut {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent(``, `  `)
+		if err = enc.Encode(modules); err != nil {
+			return err
+		}
+	} else {
+		for _, m := range modules {
+			fmt.Fprintf(&buf, "%s %s %s\n", m.Path, m.Dir, m.Version)
+		}
+	}
+	_, err = buf.WriteTo(stdout)
+	return err
+}
+
+// workspaceVersion get version of module in dir use relative to workspace dir, in the repository containing it
+func (o *options) workspaceVersion(ctx context.Context, stderr io.Writer, workspace, use string) (m workspaceModule, err error) {
+	m.Dir = use
+	dir := use
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workspace, dir)
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	if _, err = os.Stat(filepath.Join(dir, `go.mod`)); err != nil {
+		return
+	}
+	gitRoot, modPath, rel, err := moduleRoot(dir) // go.mod in dir is the nearest
+	if err != nil {
+		return
+	}
+	m.Path = modPath
+	opts := o.opts
+	opts.Logger = o.newLogger(stderr).With(`repo`, gitRoot, `module`, m.Path)
+	if rel != `.` {
+		m.TagPrefix = version.ModuleTagPrefix(m.Path, rel)
+		opts.TagPrefix, opts.Paths = m.TagPrefix, []string{rel}
+	}
+	m.Version, err = version.Field(ctx, gitRoot, `Version`, opts)
+	return
+}
+
+// moduleRoot find go.mod in dir or its nearest parent dir inside the repository containing dir, and the '.git' dir
+// of the repository, rel is the slash separated dir of go.mod in the worktree, modPath is empty if there is no go.mod
+func moduleRoot(dir string) (gitRoot, modPath, rel string, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	modDir := ``
+	for d := dir; gitRoot == ``; d = filepath.Dir(d) {
+		if modDir == `` {
+			if data, err := os.ReadFile(filepath.Join(d, `go.mod`)); err == nil {
+				modDir, modPath = d, modfile.ModulePath(data)
+			}
+		}
+		if _, err = os.Stat(filepath.Join(d, `.git`)); err == nil {
+			gitRoot = filepath.Join(d, `.git`)
+		} else if !errors.Is(err, os.ErrNotExist) || filepath.Dir(d) == d {
+			return ``, ``, ``, fmt.Errorf("%w: no git repository contains %s", version.ErrNoRepository, dir)
+		}
+	}
+	if modDir == `` {
+		return gitRoot, ``, ``, nil
+	}
+	if rel, err = filepath.Rel(version.WorktreeDir(gitRoot), modDir); err != nil {
+		return
+	}
+	return gitRoot, modPath, filepath.ToSlash(rel), nil
+}